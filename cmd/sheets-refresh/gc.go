@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rusq/xls2sheets"
+)
+
+// gcCommand runs the "gc" command, that deletes the temporary spreadsheets
+// left on Google Drive, and returns the exit code.
+func gcCommand(client *http.Client, args []string) int {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] gc [gc flags]\n\n"+
+			"Deletes the temporary spreadsheets left on Google Drive by the crashed tasks,\n"+
+			"or the tasks with leave_junk.\n\ngc flags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	var opts xls2sheets.GCOptions
+	fs.DurationVar(&opts.OlderThan, "age", xls2sheets.DefaultGCAge, "delete the files older than `duration`")
+	fs.BoolVar(&opts.Trash, "trash", false, "move the files to the trash instead of deleting them")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "list the files without deleting them")
+	fs.StringVar(&opts.FolderID, "folder", *tempFolder, "collect the files in the Drive folder with the `ID`, i.e. on the shared drive, instead of the files owned by the user")
+	if err := fs.Parse(args); err != nil {
+		return exitConfig
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	files, err := xls2sheets.CollectGarbage(ctx, client, opts)
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	switch {
+	case len(files) == 0:
+		fmt.Println("no temporary files found")
+	case opts.DryRun:
+		fmt.Printf("%d temporary files found, run without -dry-run to delete them\n", len(files))
+	case opts.Trash:
+		fmt.Printf("%d temporary files moved to the trash\n", len(files))
+	default:
+		fmt.Printf("%d temporary files deleted\n", len(files))
+	}
+	return exitOK
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/rusq/xls2sheets"
 	"github.com/rusq/xls2sheets/internal/authmgr"
@@ -22,18 +28,52 @@ var (
 
 var exepath = filepath.Dir(os.Args[0])
 
+// exit codes
+const (
+	exitOK      = iota
+	exitError   // unclassified error
+	exitConfig  // invalid command line or job configuration
+	exitAuth    // authentication failure
+	exitPartial // some of the tasks have failed
+	exitFailure // all tasks have failed
+)
+
 // command line parameters
 var (
 	resetAuth = flag.Bool("reset", false, "deletes the locally stored token before execution\n"+
 		"this will trigger reauthentication")
 	jobConfig   = flag.String("job", "", "configuration `file` with job definition")
 	consoleAuth = flag.Bool("console", false, "use text authentication prompts instead of opening browser")
+	deviceAuth  = flag.Bool("device", false, "authenticate with a code entered on another device (Google refuses it for the Sheets and Drive scopes, use -export-token instead)")
 	ver         = flag.Bool("version", false, "print program version and quit")
+	parallel    = flag.Int("parallel", 1, "`number` of tasks to run in parallel")
+	onError     = flag.String("on-error", xls2sheets.OnErrorContinue, "default error `policy` for tasks: continue or abort")
+	plan        = flag.Bool("plan", false, "print the changes that the job would make, without changing the targets")
+	force       = flag.Bool("force", false, "run all tasks, even if their sources have not changed")
+	retries     = flag.Int("retries", 5, "maximum `number` of attempts for the failed requests, 1 disables retries")
+	readRate    = flag.Int("reads-per-minute", 0, "maximum `number` of Google API read requests per minute, 0 is unlimited")
+	writeRate   = flag.Int("writes-per-minute", 0, "maximum `number` of Google API write requests per minute, 0 is unlimited")
+	gcAge       = flag.Duration("gc-age", 0, "delete the temporary files older than `duration` before running the job, 0 disables")
+	tempFolder  = flag.String("temp-folder", "", "Drive folder `ID` for the temporary spreadsheets, may be on the shared drive; tasks may override it with temp_folder_id")
 
 	defaultCredentialsFile = filepath.Join(exepath, ".refresh-credentials.json")
 	credentials            = flag.String("auth", defaultCredentialsFile, "file with authentication data")
+	serviceAccount         = flag.String("service-account", "", "service account key `file`, used instead of the interactive authentication")
+	subject                = flag.String("subject", "", "`email` of the user to impersonate with -service-account or -adc (domain-wide delegation)")
+	useADC                 = flag.Bool("adc", false, "use Application Default Credentials instead of the interactive authentication")
+	profile                = flag.String("profile", "", "auth `profile` for the tasks without the profile, each profile stores the token of its own Google account")
+	listProfiles           = flag.Bool("list-profiles", false, "list the auth profiles that have the stored token and quit")
+	revokeAuth             = flag.Bool("revoke", false, "revoke the token of the -profile and quit")
+	tokenKey               = flag.String("token-key", "", "encrypt the stored tokens with the key from the `file`, or set the "+passphraseEnv+" environment variable")
+	useKeyring             = flag.Bool("keyring", false, "store the tokens in the system keyring (Secret Service)")
+	exportToken            = flag.String("export-token", "", "export the token of the -profile to the JSON `file` (- for stdout) and quit")
+	importToken            = flag.String("import-token", "", "import the token of the -profile from the JSON `file` (- for stdin) and quit")
 )
 
+// passphraseEnv is the environment variable with the passphrase to encrypt
+// the stored tokens.
+const passphraseEnv = "SHEETS_REFRESH_TOKEN_PASSPHRASE"
+
 func mustStr(s string, err error) string {
 	if err != nil {
 		panic(err)
@@ -41,6 +81,110 @@ func mustStr(s string, err error) string {
 	return s
 }
 
+// fatal logs the message and exits with the exit code.
+func fatal(code int, v ...interface{}) {
+	log.Print(v...)
+	os.Exit(code)
+}
+
+// deviceScopeHowTo explains how to authorize the remote machine, if the
+// device flow was refused.
+const deviceScopeHowTo = `Google does not allow the device authorization (-device) for the
+Sheets and Drive access that sheets-refresh needs.  Authorize on a machine
+with the browser, and transfer the token with -export-token and
+-import-token, or use -service-account.`
+
+// authFailed exits with the authentication error.
+func authFailed(err error) {
+	if errors.Is(err, authmgr.ErrDeviceScope) {
+		log.Print(deviceScopeHowTo)
+	}
+	fatal(exitAuth, err)
+}
+
+// exitCode returns the exit code for the job execution error.
+func exitCode(err error) int {
+	var jobErr *xls2sheets.JobError
+	switch {
+	case err == nil:
+		return exitOK
+	case !errors.As(err, &jobErr):
+		return exitConfig
+	case jobErr.Succeeded() == 0:
+		return exitFailure
+	default:
+		return exitPartial
+	}
+}
+
+// tokenStoreOpts returns the options for the token store specified on the
+// command line.
+func tokenStoreOpts() ([]authmgr.Option, error) {
+	passphrase := []byte(os.Getenv(passphraseEnv))
+	if *tokenKey != "" {
+		var err error
+		if passphrase, err = authmgr.ReadKeyFile(*tokenKey); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case *useKeyring && len(passphrase) > 0:
+		return nil, errors.New("the tokens in the keyring can not be encrypted with -token-key")
+	case *useKeyring:
+		return []authmgr.Option{authmgr.OptTokenStore(authmgr.NewKeyringStore("sheets-refresh", nil))}, nil
+	case len(passphrase) > 0:
+		return []authmgr.Option{authmgr.OptEncryptTokens(passphrase)}, nil
+	}
+	return nil, nil
+}
+
+// transferToken exports the token of the profile to the file, or imports it
+// from the file.  "-" is stdout or stdin.
+func transferToken(mgr *authmgr.Manager) error {
+	if *exportToken != "" {
+		if *exportToken == "-" {
+			return mgr.ExportToken(os.Stdout)
+		}
+		f, err := os.OpenFile(*exportToken, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		if err := mgr.ExportToken(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	if *importToken == "-" {
+		return mgr.ImportToken(os.Stdin)
+	}
+	f, err := os.Open(*importToken)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return mgr.ImportToken(f)
+}
+
+// newManager creates the authentication manager for the credentials
+// specified on the command line.
+func newManager(opts ...authmgr.Option) (*authmgr.Manager, error) {
+	scopes := []string{sheets.SpreadsheetsScope, drive.DriveScope}
+	switch {
+	case *serviceAccount != "" && *useADC:
+		return nil, errors.New("-service-account and -adc can not be used together")
+	case *serviceAccount != "":
+		return authmgr.NewFromServiceAccount(*serviceAccount, scopes, *subject, opts...)
+	case *useADC:
+		return authmgr.NewFromDefaultCredentials(scopes, *subject, opts...)
+	case *subject != "":
+		return nil, errors.New("-subject requires -service-account or -adc")
+	default:
+		// prepare config from provided credentials file
+		return authmgr.NewFromGoogleCreds(*credentials, scopes, opts...)
+	}
+}
+
 func main() {
 	flag.Parse()
 
@@ -49,55 +193,172 @@ func main() {
 		os.Exit(0)
 	}
 
-	_, err := os.Stat(*credentials)
-	if err != nil {
-		fmt.Printf(credentialsHowTo, *credentials)
-		os.Exit(1)
+	// the interactive authentication requires the credentials file.
+	if *serviceAccount == "" && !*useADC {
+		if _, err := os.Stat(*credentials); err != nil {
+			fmt.Printf(credentialsHowTo, *credentials)
+			os.Exit(exitAuth)
+		}
 	}
 
-	opts := []authmgr.Option{
+	// common options of the managers of all profiles.
+	common := []authmgr.Option{
 		authmgr.OptTryWebAuth(!*consoleAuth, "/", ""),
 		authmgr.OptAppName("rusq", "sheets-refresh"),
 		authmgr.OptUseIndexPage(true),
+		authmgr.OptDeviceAuth(*deviceAuth),
+	}
+	storeOpts, err := tokenStoreOpts()
+	if err != nil {
+		fatal(exitConfig, err)
 	}
+	common = append(common, storeOpts...)
+	// options of the -profile manager, -reset applies only to it.
+	opts := append([]authmgr.Option{authmgr.OptProfile(*profile)}, common...)
 	if *resetAuth {
 		opts = append(opts, authmgr.OptResetAuth())
 	}
 
+	// profile commands do not need the job.
+	switch {
+	case *listProfiles:
+		mgr, err := newManager(opts...)
+		if err != nil {
+			fatal(exitAuth, err)
+		}
+		profiles, err := mgr.Profiles()
+		if err != nil {
+			fatal(exitAuth, err)
+		}
+		for _, p := range profiles {
+			fmt.Println(p)
+		}
+		os.Exit(exitOK)
+	case *revokeAuth:
+		mgr, err := newManager(opts...)
+		if err != nil {
+			fatal(exitAuth, err)
+		}
+		if err := mgr.Revoke(); err != nil {
+			fatal(exitAuth, fmt.Errorf("profile %q: %w", mgr.Profile(), err))
+		}
+		fmt.Printf("profile %q: token revoked\n", mgr.Profile())
+		os.Exit(exitOK)
+	case *exportToken != "" || *importToken != "":
+		mgr, err := newManager(opts...)
+		if err != nil {
+			fatal(exitAuth, err)
+		}
+		if err := transferToken(mgr); err != nil {
+			fatal(exitAuth, fmt.Errorf("profile %q: %w", mgr.Profile(), err))
+		}
+		os.Exit(exitOK)
+	}
+
+	switch flag.Arg(0) {
+	case "":
+	case "gc":
+		mgr, err := newManager(opts...)
+		if err != nil {
+			fatal(exitAuth, err)
+		}
+		client, err := mgr.Client()
+		if err != nil {
+			authFailed(err)
+		}
+		os.Exit(gcCommand(client, flag.Args()[1:]))
+	default:
+		fatal(exitConfig, fmt.Sprintf("unknown command: %q", flag.Arg(0)))
+	}
+
 	// check parameters
 	if *jobConfig == "" {
 		if *resetAuth {
-			os.Exit(0) // exiting without error if we were asked to just reset
+			// the token is removed when the manager is created.
+			if _, err := newManager(opts...); err != nil {
+				fatal(exitAuth, err)
+			}
+			os.Exit(exitOK) // exiting without error if we were asked to just reset
 		}
-		log.Fatal("no -job <yaml file> specified")
+		fatal(exitConfig, "no -job <yaml file> specified")
 	}
 
 	// read the configuration file
 	jobData, err := ioutil.ReadFile(*jobConfig)
 	if err != nil {
-		log.Fatal(err)
+		fatal(exitConfig, err)
 	}
 
 	// initialise job from the configuration file data
 	job, err := xls2sheets.NewJobFromConfig(jobData)
 	if err != nil {
-		log.Fatal(err)
+		fatal(exitConfig, err)
 	}
+	job.Parallel = *parallel
+	job.OnError = *onError
+	job.Retry.MaxAttempts = *retries
+	job.RateLimit = xls2sheets.RateLimit{ReadsPerMinute: *readRate, WritesPerMinute: *writeRate}
+	job.TempFolderID = *tempFolder
 
-	// prepare config from provided credentials file
-	mgr, err := authmgr.NewFromGoogleCreds(*credentials, []string{sheets.SpreadsheetsScope, drive.DriveScope}, opts...)
+	mgr, err := newManager(opts...)
 	if err != nil {
-		log.Fatal(err)
+		fatal(exitAuth, err)
 	}
 
 	// initialising client
 	client, err := mgr.Client()
 	if err != nil {
-		log.Fatal(err)
+		authFailed(err)
+	}
+	// clients of the profiles that the tasks refer to.
+	job.Clients = make(map[string]*http.Client)
+	for _, name := range job.Profiles() {
+		pm, err := newManager(append([]authmgr.Option{authmgr.OptProfile(name)}, common...)...)
+		if err != nil {
+			fatal(exitAuth, err)
+		}
+		if job.Clients[name], err = pm.Client(); err != nil {
+			authFailed(fmt.Errorf("profile %q: %w", name, err))
+		}
+	}
+
+	// the temporary files are recorded in the journal, so that the files
+	// left by the crashed run are deleted on the next start.
+	jobName := strings.TrimSuffix(filepath.Base(*jobConfig), filepath.Ext(*jobConfig))
+	if job.Journal, err = xls2sheets.OpenJournal(filepath.Join(mgr.CacheDir(), "journal", jobName+".json")); err != nil {
+		fatal(exitConfig, err)
+	}
+
+	// cancel the job on interrupt, temporary files are still cleaned up.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *plan {
+		plans, err := job.PlanContext(ctx, client)
+		for _, p := range plans {
+			fmt.Print(p)
+		}
+		if err != nil {
+			stop()
+			fatal(exitCode(err), err)
+		}
+		return
+	}
+
+	// the state of the sources is kept between the runs, so that the
+	// tasks with unchanged sources are skipped.
+	stateFile := filepath.Join(mgr.CacheDir(), "state", jobName+".json")
+	if job.State, err = xls2sheets.LoadState(stateFile); err != nil {
+		fatal(exitConfig, err)
+	}
+	job.Force = *force
+	if *gcAge > 0 {
+		job.GC = &xls2sheets.GCOptions{OlderThan: *gcAge}
 	}
 
 	// running job
-	if err := job.Execute(client); err != nil {
-		log.Fatal(err)
+	if err := job.ExecuteContext(ctx, client); err != nil {
+		stop()
+		fatal(exitCode(err), err)
 	}
 }
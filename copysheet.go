@@ -0,0 +1,87 @@
+package xls2sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+var (
+	errCopySheetMode  = errors.New("copy_sheet can only be used in overwrite mode")
+	errCopySheetLocal = errors.New("copy_sheet can not be used with the local source")
+	errCopySheetRange = errors.New("copy_sheet requires the sheet names, not ranges")
+	errReplaceSheet   = errors.New("replace_sheet requires copy_sheet")
+)
+
+// checkCopySheet checks that the source and target addresses are the sheet
+// names, as the whole sheets are copied.
+func checkCopySheet(srcAddressRange, trgAddress []string) error {
+	for i := range srcAddressRange {
+		if strings.Contains(srcAddressRange[i], "!") || strings.Contains(trgAddress[i], "!") {
+			return fmt.Errorf("%w: %q to %q", errCopySheetRange, srcAddressRange[i], trgAddress[i])
+		}
+	}
+	return nil
+}
+
+// copier returns the Google Spreadsheet to copy the sheets from, if the
+// target has CopySheet set, or nil otherwise.  Sheets can not be copied
+// from the local source.
+func (trg *Target) copier(sourcer sheetReader, srcAddressRange, trgAddress []string) (*sheetSvc, error) {
+	if !trg.CopySheet {
+		return nil, nil
+	}
+	src, ok := sourcer.(*sheetSvc)
+	if !ok {
+		return nil, errCopySheetLocal
+	}
+	if err := checkCopySheet(srcAddressRange, trgAddress); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// copySheet copies the source sheet with the formatting, merges, conditional
+// formatting and data validation to the target spreadsheet, and pastes the
+// copy into the target sheet, which must exist.  If the target has
+// ReplaceSheet set, the copy, with its charts, is put in place of the target
+// sheet instead.
+func (trg *Target) copySheet(ctx context.Context, updater, src *sheetSvc, srcAddress, trgAddress string) error {
+	log.Printf("  * copy sheet %q to %q", srcAddress, trgAddress)
+	srcSheet, err := src.findSheet(ctx, sheetName(srcAddress))
+	if err != nil {
+		return err
+	}
+	if srcSheet == nil {
+		return fmt.Errorf("source sheet not found: %q", srcAddress)
+	}
+	trgSheet, err := updater.findSheet(ctx, sheetName(trgAddress))
+	if err != nil {
+		return err
+	}
+	if trgSheet == nil {
+		return fmt.Errorf("target sheet not found: %q", trgAddress)
+	}
+	copied, err := src.copyTo(ctx, srcSheet.SheetId, updater.spreadsheetID)
+	if err != nil {
+		return err
+	}
+	put, done := updater.pasteSheet, "    * OK: sheet pasted"
+	if trg.ReplaceSheet {
+		put, done = updater.replaceSheet, "    * OK: sheet replaced"
+	}
+	if err := put(ctx, trgSheet, copied.SheetId); err != nil {
+		// the target sheet is unchanged, the copy must not be left behind,
+		// even if the task was cancelled.
+		ctx, cancel := context.WithTimeout(detached{ctx}, cleanupTimeout)
+		defer cancel()
+		if err := updater.deleteSheet(ctx, copied.SheetId); err != nil {
+			log.Printf("    * failed to delete the copy %q: %s", copied.Title, err)
+		}
+		return err
+	}
+	log.Print(done)
+	return nil
+}
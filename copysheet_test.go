@@ -0,0 +1,149 @@
+package xls2sheets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeSheets is the fake Sheets API with the source spreadsheet "src" and
+// the target spreadsheet "trg".
+type fakeSheets struct {
+	mu      sync.Mutex
+	copied  []string // copyTo request paths
+	batches []string // batchUpdate request bodies
+}
+
+func (fs *fakeSheets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v4/spreadsheets/src":
+		json.NewEncoder(w).Encode(map[string]interface{}{"sheets": []interface{}{
+			map[string]interface{}{"properties": map[string]interface{}{"sheetId": 7, "title": "Data", "index": 0}},
+		}})
+	case r.Method == http.MethodGet && r.URL.Path == "/v4/spreadsheets/trg":
+		list := []interface{}{
+			map[string]interface{}{
+				"properties":         map[string]interface{}{"sheetId": 0, "title": "Rates", "index": 0, "gridProperties": map[string]interface{}{"rowCount": 1000, "columnCount": 5}},
+				"conditionalFormats": []interface{}{map[string]interface{}{}, map[string]interface{}{}},
+			},
+			map[string]interface{}{"properties": map[string]interface{}{"sheetId": 5, "title": "Summary", "index": 1}},
+		}
+		if len(fs.copied) > 0 && len(fs.batches) == 0 {
+			list = append(list, map[string]interface{}{"properties": map[string]interface{}{"sheetId": 99, "title": "Copy of Data", "index": 2, "gridProperties": map[string]interface{}{"rowCount": 50, "columnCount": 10, "frozenRowCount": 1}}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sheets": list})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, ":copyTo"):
+		fs.copied = append(fs.copied, r.URL.Path)
+		json.NewEncoder(w).Encode(map[string]interface{}{"sheetId": 99, "title": "Copy of Data", "index": 2})
+	case r.Method == http.MethodPost && r.URL.Path == "/v4/spreadsheets/trg:batchUpdate":
+		body, _ := io.ReadAll(r.Body)
+		fs.batches = append(fs.batches, string(body))
+		json.NewEncoder(w).Encode(map[string]string{"spreadsheetId": "trg"})
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestTarget_update_copySheet(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace bool
+		want    []map[string]map[string]interface{}
+	}{
+		{
+			// the copy is pasted into the target sheet, that is cleared
+			// first, and is never shrunk.
+			"paste", false, []map[string]map[string]interface{}{
+				{"unmergeCells": {"range": map[string]interface{}{"sheetId": 0.0}}},
+				{"updateCells": {"range": map[string]interface{}{"sheetId": 0.0}, "fields": "*"}},
+				{"deleteConditionalFormatRule": {"sheetId": 0.0, "index": 1.0}},
+				{"deleteConditionalFormatRule": {"sheetId": 0.0, "index": 0.0}},
+				{"updateSheetProperties": {
+					"properties": map[string]interface{}{"sheetId": 0.0, "gridProperties": map[string]interface{}{"rowCount": 1000.0, "columnCount": 10.0, "frozenRowCount": 1.0, "frozenColumnCount": 0.0}},
+					"fields":     "gridProperties(rowCount,columnCount,frozenRowCount,frozenColumnCount)",
+				}},
+				{"copyPaste": {
+					"source":      map[string]interface{}{"sheetId": 99.0},
+					"destination": map[string]interface{}{"sheetId": 0.0, "endRowIndex": 1.0, "endColumnIndex": 1.0},
+					"pasteType":   "PASTE_NORMAL",
+				}},
+				{"deleteSheet": {"sheetId": 99.0}},
+			},
+		},
+		{
+			// the copy takes the ID, title and index of the replaced sheet.
+			"replace", true, []map[string]map[string]interface{}{
+				{"deleteSheet": {"sheetId": 0.0}},
+				{"duplicateSheet": {"sourceSheetId": 99.0, "newSheetId": 0.0, "newSheetName": "Rates", "insertSheetIndex": 0.0}},
+				{"deleteSheet": {"sheetId": 99.0}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fs := &fakeSheets{}
+			client := apiClient(t, fs)
+			src, err := newSheetSvc(client, "src")
+			if err != nil {
+				t.Fatal(err)
+			}
+			trg := &Target{SpreadsheetID: "trg", SheetAddress: []string{"Rates"}, CopySheet: true, ReplaceSheet: tt.replace}
+			if err := trg.update(ctx, client, src, []string{"Data"}); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"/v4/spreadsheets/src/sheets/7:copyTo"}, fs.copied); diff != "" {
+				t.Errorf("copyTo (-want,+got):\n%s", diff)
+			}
+			if len(fs.batches) != 1 {
+				t.Fatalf("got %d batch updates, want 1", len(fs.batches))
+			}
+			var got struct {
+				Requests []map[string]map[string]interface{} `json:"requests"`
+			}
+			if err := json.Unmarshal([]byte(fs.batches[0]), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got.Requests); diff != "" {
+				t.Errorf("batchUpdate (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTarget_update_copySheetErrors(t *testing.T) {
+	ctx := context.Background()
+	client := apiClient(t, &fakeSheets{})
+	src, err := newSheetSvc(client, "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		trg     *Target
+		sourcer sheetReader
+		srcAddr []string
+		wantErr error
+	}{
+		{"range", &Target{SpreadsheetID: "trg", SheetAddress: []string{"Rates!A1"}, CopySheet: true}, src, []string{"Data"}, errCopySheetRange},
+		{"append", &Target{SpreadsheetID: "trg", SheetAddress: []string{"Rates"}, Mode: ModeAppend, CopySheet: true}, src, []string{"Data"}, errCopySheetMode},
+		{"local", &Target{SpreadsheetID: "trg", SheetAddress: []string{"Rates"}, CopySheet: true}, &workbook{sheets: []*worksheet{{title: "Data"}}}, []string{"Data"}, errCopySheetLocal},
+		{"replace", &Target{SpreadsheetID: "trg", SheetAddress: []string{"Rates"}, ReplaceSheet: true}, src, []string{"Data"}, errReplaceSheet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.trg.update(ctx, client, tt.sourcer, tt.srcAddr); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Target.update() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
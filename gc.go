@@ -0,0 +1,204 @@
+package xls2sheets
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// DefaultGCAge is the default age of the temporary files that are collected
+// by CollectGarbage.  It is large enough not to delete the files of the
+// tasks that are still running.
+const DefaultGCAge = 24 * time.Hour
+
+// GCOptions are the options of CollectGarbage.
+type GCOptions struct {
+	// OlderThan is the minimum age of the temporary files to collect, if
+	// zero, DefaultGCAge is used.
+	OlderThan time.Duration
+	// Trash moves the files to the trash, instead of deleting them
+	// permanently.
+	Trash bool
+	// DryRun only lists the files, without deleting them.
+	DryRun bool
+	// FolderID (optional) is the ID of the Drive folder with the temporary
+	// files, i.e. on the shared drive.  If empty, the files owned by the
+	// user are collected.
+	FolderID string
+}
+
+// TempFile is the temporary spreadsheet on Google Drive.
+type TempFile struct {
+	ID          string
+	Name        string
+	CreatedTime time.Time
+}
+
+func (f TempFile) String() string {
+	return fmt.Sprintf("%s (%s, created %s)", f.Name, f.ID, f.CreatedTime.Local().Format(time.RFC3339))
+}
+
+// ListTempFiles returns the temporary spreadsheets, that were created by
+// the tasks and left on Google Drive, i.e. if the task has crashed or had
+// leave_junk set, that are older than olderThan.  If folderID is not empty,
+// the files in that folder are returned, otherwise, the files owned by the
+// user.
+func ListTempFiles(ctx context.Context, client *http.Client, olderThan time.Duration, folderID string) ([]TempFile, error) {
+	srv, err := drive.New(client)
+	if err != nil {
+		return nil, err
+	}
+	before := time.Now().Add(-olderThan).UTC().Format(time.RFC3339)
+	q := fmt.Sprintf("name contains '%s' and mimeType = '%s' and %s and trashed = false and createdTime < '%s'", tempFilePrefix, gsheetMIME, ownerQuery(folderID), before)
+
+	var files []TempFile
+	err = retry(ctx, func() error {
+		files = files[:0]
+		return listAllDrives(srv.Files.List(), folderID).
+			Q(q).
+			Fields("nextPageToken, files(id, name, createdTime)").
+			Context(ctx).
+			Pages(ctx, func(fl *drive.FileList) error {
+				for _, f := range fl.Files {
+					// "contains" matches the word prefix, the name must start
+					// with the prefix.
+					if !strings.HasPrefix(f.Name, tempFilePrefix) {
+						continue
+					}
+					created, err := time.Parse(time.RFC3339, f.CreatedTime)
+					if err != nil {
+						return fmt.Errorf("file %s: %w", f.Id, err)
+					}
+					files = append(files, TempFile{ID: f.Id, Name: f.Name, CreatedTime: created})
+				}
+				return nil
+			})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// CollectGarbage deletes the temporary spreadsheets, that are older than
+// opts.OlderThan, from Google Drive.  It returns the files that were found,
+// and the error if any of them could not be deleted.  The files are only
+// listed, if opts.DryRun is true.
+func CollectGarbage(ctx context.Context, client *http.Client, opts GCOptions) ([]TempFile, error) {
+	if opts.OlderThan <= 0 {
+		opts.OlderThan = DefaultGCAge
+	}
+	files, err := ListTempFiles(ctx, client, opts.OlderThan, opts.FolderID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun || len(files) == 0 {
+		return files, nil
+	}
+	srv, err := drive.New(client)
+	if err != nil {
+		return files, err
+	}
+	var failed int
+	for _, f := range files {
+		if opts.Trash {
+			log.Printf("  * trashing %s", f)
+			err = retry(ctx, func() error {
+				_, err := srv.Files.Update(f.ID, &drive.File{Trashed: true}).SupportsAllDrives(true).Context(ctx).Do()
+				return err
+			})
+		} else {
+			log.Printf("  * deleting %s", f)
+			err = retry(ctx, func() error {
+				return srv.Files.Delete(f.ID).SupportsAllDrives(true).Context(ctx).Do()
+			})
+		}
+		if err != nil {
+			log.Printf("    * failed: %s", err)
+			failed++
+		}
+		if ctx.Err() != nil {
+			return files, ctx.Err()
+		}
+	}
+	if failed > 0 {
+		return files, fmt.Errorf("%d of %d temporary files could not be deleted", failed, len(files))
+	}
+	return files, nil
+}
+
+// ownerQuery returns the Drive query condition, that selects the files in
+// the folder, or the files owned by the user, if the folder is empty.
+func ownerQuery(folderID string) string {
+	if folderID == "" {
+		return "'me' in owners"
+	}
+	return fmt.Sprintf("'%s' in parents", folderID)
+}
+
+// listAllDrives makes the list call include the files on the shared drives,
+// if the folder is set, as the files on the shared drives are not owned by
+// the user.
+func listAllDrives(call *drive.FilesListCall, folderID string) *drive.FilesListCall {
+	call = call.SupportsAllDrives(true)
+	if folderID == "" {
+		return call
+	}
+	return call.Corpora("allDrives").IncludeItemsFromAllDrives(true)
+}
+
+// collectGarbage collects the temporary files of each of the job clients, in
+// each of the temporary folders that the tasks of the client use.  Errors are
+// logged, they do not fail the job.
+func (j *Job) collectGarbage(ctx context.Context, clients profileClients) {
+	profiles := make([]string, 0, len(clients))
+	for profile := range clients {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	for _, profile := range profiles {
+		name := profile
+		if name == "" {
+			name = "default"
+		}
+		for _, folder := range j.tempFolders(profile) {
+			opts := *j.GC
+			opts.FolderID = folder
+			log.Printf("collecting the temporary files (profile %q)", name)
+			files, err := CollectGarbage(ctx, clients[profile], opts)
+			if err != nil {
+				log.Printf("failed to collect the temporary files (profile %q): %s", name, err)
+				continue
+			}
+			log.Printf("%d temporary files collected (profile %q)", len(files), name)
+		}
+	}
+}
+
+// tempFolders returns the sorted temporary folders of the tasks, that read
+// the source with the profile.  Empty string stands for My Drive root.
+func (j *Job) tempFolders(profile string) []string {
+	seen := make(map[string]bool)
+	var folders []string
+	for _, task := range j.Tasks {
+		if task.sourceProfile() != profile {
+			continue
+		}
+		folder := task.tempFolder(j.TempFolderID)
+		if !seen[folder] {
+			seen[folder] = true
+			folders = append(folders, folder)
+		}
+	}
+	if len(folders) == 0 {
+		return []string{""}
+	}
+	sort.Strings(folders)
+	return folders
+}
@@ -0,0 +1,120 @@
+package xls2sheets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// redirect is the http.RoundTripper that sends all requests to the test
+// server, so that the Google API clients could be tested.
+type redirect struct {
+	target *url.URL
+}
+
+func (rt redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// apiClient starts the test server with the handler, and returns the client
+// that sends the Google API requests to it.
+func apiClient(t *testing.T, handler http.Handler) *http.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Transport: redirect{target: target}}
+}
+
+// fakeDrive is the fake Drive API with the list of temporary files.
+type fakeDrive struct {
+	mu      sync.Mutex
+	query   string
+	params  url.Values
+	deleted []string
+	trashed []string
+}
+
+func (fd *fakeDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	id := strings.TrimPrefix(r.URL.Path, "/drive/v3/files/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/drive/v3/files":
+		fd.query = r.FormValue("q")
+		fd.params = r.URL.Query()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"files": []map[string]string{
+				{"id": "1", "name": tempFilePrefix + "1600000000.xlsx", "createdTime": "2020-09-13T12:26:40Z"},
+				{"id": "2", "name": "old xls2sheets$ report", "createdTime": "2020-09-13T12:26:40Z"},
+			},
+		})
+	case r.Method == http.MethodDelete:
+		fd.deleted = append(fd.deleted, id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPatch:
+		fd.trashed = append(fd.trashed, id)
+		json.NewEncoder(w).Encode(map[string]string{"id": id})
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	ctx := context.Background()
+	want := []TempFile{{ID: "1", Name: tempFilePrefix + "1600000000.xlsx", CreatedTime: time.Unix(1600000000, 0).UTC()}}
+
+	fd := &fakeDrive{}
+	client := apiClient(t, fd)
+	files, err := CollectGarbage(ctx, client, GCOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, files); diff != "" {
+		t.Errorf("CollectGarbage() (-want,+got):\n%s", diff)
+	}
+	if len(fd.deleted) > 0 || len(fd.trashed) > 0 {
+		t.Error("CollectGarbage() dry run must not delete files")
+	}
+	if !strings.Contains(fd.query, "name contains '"+tempFilePrefix+"'") || !strings.Contains(fd.query, "createdTime < ") {
+		t.Errorf("CollectGarbage() unexpected query: %s", fd.query)
+	}
+
+	if _, err := CollectGarbage(ctx, client, GCOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CollectGarbage(ctx, client, GCOptions{Trash: true}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"1"}, fd.deleted); diff != "" {
+		t.Errorf("deleted (-want,+got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"1"}, fd.trashed); diff != "" {
+		t.Errorf("trashed (-want,+got):\n%s", diff)
+	}
+
+	// shared drive folder
+	if _, err := CollectGarbage(ctx, client, GCOptions{DryRun: true, FolderID: "folder-id"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fd.query, "'folder-id' in parents") || strings.Contains(fd.query, "'me' in owners") {
+		t.Errorf("CollectGarbage() unexpected folder query: %s", fd.query)
+	}
+	if fd.params.Get("corpora") != "allDrives" || fd.params.Get("includeItemsFromAllDrives") != "true" {
+		t.Errorf("CollectGarbage() must list all drives, got %v", fd.params)
+	}
+}
@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/goccy/go-yaml v1.9.8
 	github.com/google/go-cmp v0.5.9
+	golang.org/x/crypto v0.21.0
 	golang.org/x/oauth2 v0.5.0
 	google.golang.org/api v0.108.0
 )
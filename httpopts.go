@@ -0,0 +1,287 @@
+package xls2sheets
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// HTTP defaults.
+const (
+	defHTTPTimeout    = 5 * time.Minute
+	defConnectTimeout = 30 * time.Second
+	// idleConnTimeout is the time after which the idle keep-alive
+	// connections are closed.
+	idleConnTimeout = 90 * time.Second
+
+	// proxyDirect disables the proxy.
+	proxyDirect = "direct"
+)
+
+var errHTTPStatus = errors.New("unexpected HTTP status")
+
+// statusError is returned if the server responds with the unexpected status.
+type statusError struct {
+	url         string // redacted
+	status      string
+	contentType string
+	code        int
+	header      http.Header
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: GET %s: %s (content type: %q)", errHTTPStatus, e.url, e.status, e.contentType)
+}
+
+func (e *statusError) Unwrap() error {
+	return errHTTPStatus
+}
+
+// HTTPOptions are the options for fetching the remote source file.
+type HTTPOptions struct {
+	// InsecureSkipVerify disables the verification of the server
+	// certificate.  Use it only if you trust the network between you and
+	// the server.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+	// CAFile (optional) is the PEM file with the certificates of the
+	// certificate authorities, that are trusted in addition to the system
+	// ones.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile (optional) are the PEM files with the client
+	// certificate and its private key.
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// Timeout (optional) is the time limit for the whole request, including
+	// the download of the file, i.e. "90s".  Default is 5 minutes.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// ConnectTimeout (optional) is the time limit for establishing the
+	// connection.  Default is 30 seconds.
+	ConnectTimeout time.Duration `yaml:"connect_timeout,omitempty"`
+	// Proxy (optional) is the proxy URL, i.e. "http://proxy:3128".  If
+	// empty, the proxy is taken from the HTTPS_PROXY, HTTP_PROXY and
+	// NO_PROXY environment variables.  "direct" disables the proxy.
+	Proxy string `yaml:"proxy,omitempty"`
+	// Headers (optional) are added to the request, i.e. the API key header.
+	Headers map[string]*Secret `yaml:"headers,omitempty"`
+	// BasicAuth (optional) is the username and password for the HTTP basic
+	// authentication.
+	BasicAuth *BasicAuth `yaml:"basic_auth,omitempty"`
+	// BearerToken (optional) is sent in the Authorization header.
+	BearerToken *Secret `yaml:"bearer_token,omitempty"`
+
+	// once guards httpClient and clientErr, the client is created once and
+	// reused by all requests, so that the connections are reused as well.
+	once       sync.Once
+	httpClient *http.Client
+	clientErr  error
+}
+
+// defHTTPOptions are used when the source has no HTTP options.
+var defHTTPOptions = &HTTPOptions{}
+
+// client returns the HTTP client configured with the options.  The client is
+// created on the first call and reused afterwards.  Nil options are valid,
+// the default client settings are used then.
+func (o *HTTPOptions) client() (*http.Client, error) {
+	if o == nil {
+		o = defHTTPOptions
+	}
+	o.once.Do(func() {
+		o.httpClient, o.clientErr = o.newClient()
+	})
+	return o.httpClient, o.clientErr
+}
+
+// newClient creates the HTTP client configured with the options.
+func (o *HTTPOptions) newClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+	if o.InsecureSkipVerify {
+		log.Print("+ WARNING: server certificate verification is disabled")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if o.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(os.ExpandEnv(o.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("error reading ca_file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_file: %s", o.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(os.ExpandEnv(o.CertFile), os.ExpandEnv(o.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	switch o.Proxy {
+	case "":
+	case proxyDirect:
+		proxy = nil
+	default:
+		u, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	timeout, connectTimeout := o.Timeout, o.ConnectTimeout
+	if timeout <= 0 {
+		timeout = defHTTPTimeout
+	}
+	if connectTimeout <= 0 {
+		connectTimeout = defConnectTimeout
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: connectTimeout,
+		IdleConnTimeout:     idleConnTimeout,
+		ForceAttemptHTTP2:   true,
+	}
+	return &http.Client{Transport: transport, Timeout: timeout, CheckRedirect: o.checkRedirect}, nil
+}
+
+// maxRedirects is the number of redirects that the client follows, same as
+// the default client.
+const maxRedirects = 10
+
+// checkRedirect removes the configured headers from the redirected request,
+// if it goes to another host, so that the secrets are not sent to it.  The
+// client removes the Authorization header, set by basic_auth and
+// bearer_token, by itself.
+func (o *HTTPOptions) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Host == via[0].URL.Host {
+		return nil
+	}
+	for name := range o.Headers {
+		req.Header.Del(name)
+	}
+	return nil
+}
+
+// get sends the GET request to the remote server, header is added to the
+// request headers.  It returns an error, if the response status is not 2xx
+// or 304 (Not Modified).
+func (o *HTTPOptions) get(ctx context.Context, uri string, header http.Header) (*http.Response, error) {
+	client, err := o.client()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.authorize(req); err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactURL(urlErr.URL)
+		}
+		return nil, err
+	}
+	if (200 <= resp.StatusCode && resp.StatusCode < 300) || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return nil, &statusError{
+		url:         redactURL(uri),
+		status:      resp.Status,
+		contentType: resp.Header.Get("Content-Type"),
+		code:        resp.StatusCode,
+		header:      resp.Header,
+	}
+}
+
+// fetch gets the file from the remote server and reads it, the request is
+// retried on transient errors.  If the server responds with 304 (Not
+// Modified), the returned data is nil.
+func (o *HTTPOptions) fetch(ctx context.Context, uri string, header http.Header) (*http.Response, []byte, error) {
+	var (
+		resp *http.Response
+		data []byte
+	)
+	err := retry(ctx, func() error {
+		var err error
+		if resp, err = o.get(ctx, uri, header); err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotModified {
+			data = nil
+			return nil
+		}
+		data, err = io.ReadAll(resp.Body)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+// authorize sets the headers and credentials of the request.
+func (o *HTTPOptions) authorize(req *http.Request) error {
+	if o == nil {
+		return nil
+	}
+	for name, secret := range o.Headers {
+		value, err := secret.value()
+		if err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+		req.Header.Set(name, value)
+	}
+	if o.BasicAuth != nil {
+		username, err := o.BasicAuth.Username.value()
+		if err != nil {
+			return fmt.Errorf("basic_auth username: %w", err)
+		}
+		password, err := o.BasicAuth.Password.value()
+		if err != nil {
+			return fmt.Errorf("basic_auth password: %w", err)
+		}
+		req.SetBasicAuth(username, password)
+	}
+	if o.BearerToken != nil {
+		token, err := o.BearerToken.value()
+		if err != nil {
+			return fmt.Errorf("bearer_token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
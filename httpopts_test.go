@@ -0,0 +1,160 @@
+package xls2sheets
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestHTTPOptions_get(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rates.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("a,b\n"))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       *HTTPOptions
+		path       string
+		wantErr    bool
+		wantStatus bool
+	}{
+		{"verification on by default", nil, "/rates.csv", true, false},
+		{"insecure", &HTTPOptions{InsecureSkipVerify: true}, "/rates.csv", false, false},
+		{"ca file", &HTTPOptions{CAFile: caFile}, "/rates.csv", false, false},
+		{"not found", &HTTPOptions{CAFile: caFile}, "/missing.csv", true, true},
+		{"missing ca file", &HTTPOptions{CAFile: filepath.Join(t.TempDir(), "none.pem")}, "/rates.csv", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.opts.get(context.Background(), srv.URL+tt.path, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HTTPOptions.get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if got := errors.Is(err, errHTTPStatus); got != tt.wantStatus {
+					t.Errorf("HTTPOptions.get() error = %v, want status error: %v", err, tt.wantStatus)
+				}
+				return
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestHTTPOptions_yaml(t *testing.T) {
+	var src Source
+	config := "location: https://example.com/rates.xlsx\nhttp:\n  timeout: 90s\n  proxy: direct\n"
+	if err := yaml.Unmarshal([]byte(config), &src); err != nil {
+		t.Fatal(err)
+	}
+	if src.HTTP == nil || src.HTTP.Timeout != 90*time.Second || src.HTTP.Proxy != proxyDirect {
+		t.Errorf("unexpected http options: %+v", src.HTTP)
+	}
+}
+
+func TestHTTPOptions_authorize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "bob" || pass != "pa55" || r.Header.Get("X-Api-Key") != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("a,b\n"))
+	}))
+	defer srv.Close()
+	t.Setenv("XLS2SHEETS_TEST_PASSWORD", "pa55")
+
+	opts := &HTTPOptions{
+		Headers: map[string]*Secret{"X-Api-Key": {Value: "s3cr3t"}},
+		BasicAuth: &BasicAuth{
+			Username: &Secret{Value: "bob"},
+			Password: &Secret{Env: "XLS2SHEETS_TEST_PASSWORD"},
+		},
+	}
+	resp, err := opts.get(context.Background(), srv.URL+"/rates.csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	opts.BasicAuth.Password = &Secret{Value: "wrong"}
+	if _, err := opts.get(context.Background(), srv.URL+"/rates.csv", nil); !errors.Is(err, errHTTPStatus) {
+		t.Errorf("HTTPOptions.get() expected status error, got: %v", err)
+	}
+}
+
+func TestHTTPOptions_checkRedirect(t *testing.T) {
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("X-Api-Key")
+		w.Write([]byte("a,b\n"))
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/local":
+			http.Redirect(w, r, "/rates.csv", http.StatusFound)
+		case "/other":
+			http.Redirect(w, r, other.URL+"/rates.csv", http.StatusFound)
+		default:
+			w.Write([]byte("a,b\n"))
+		}
+	}))
+	defer srv.Close()
+
+	opts := &HTTPOptions{Headers: map[string]*Secret{"X-Api-Key": {Value: "s3cr3t"}}}
+	// the headers are kept on the same host.
+	resp, err := opts.get(context.Background(), srv.URL+"/local", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// and removed, if the redirect goes to another host.
+	resp, err = opts.get(context.Background(), srv.URL+"/other", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if leaked != "" {
+		t.Errorf("secret header was sent to another host: %q", leaked)
+	}
+}
+
+func TestHTTPOptions_client_reused(t *testing.T) {
+	for _, opts := range []*HTTPOptions{nil, {Timeout: time.Minute}} {
+		first, err := opts.client()
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := opts.client()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != second {
+			t.Errorf("client() must return the same client for %+v", opts)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -38,6 +39,14 @@ type Manager struct {
 	config *oauth2.Config
 
 	reqFunc tokenReqFunc
+	// tokenSource is set for the non-interactive credentials, i.e. service
+	// account, then the token is never requested from the user.
+	tokenSource oauth2.TokenSource
+	// requests are the pending requests of the browser flow, initialised
+	// by Handlers.
+	requests *authRequests
+	// store keeps the tokens, by default, in the cache directory.
+	store TokenStore
 
 	cacheDir string
 
@@ -51,6 +60,12 @@ type options struct {
 	listenerAddr    string
 	tryWebAuth      bool
 	useIndexPage    bool
+	deviceAuth      bool
+	deviceAuthURL   string // for tests
+	revokeURL       string // for tests
+	profile         string
+	resetAuth       bool
+	passphrase      []byte // encrypt the tokens in the cache directory
 
 	vendor  string
 	appname string
@@ -65,14 +80,27 @@ func applyOpts(m *Manager, opts ...Option) (*Manager, error) {
 			return nil, err
 		}
 	}
-	m.setBrowserAuth(m.opts.tryWebAuth, m.opts.listenerAddr, m.opts.redirectURLBase)
+	switch {
+	case m.config == nil:
+		// non-interactive credentials.
+	case m.opts.deviceAuth:
+		m.reqFunc = m.deviceTokenRequest
+	default:
+		m.setBrowserAuth(m.opts.tryWebAuth, m.opts.listenerAddr, m.opts.redirectURLBase)
+	}
 
 	return m, nil
 }
 
 // New creates a new instance of Manager from oauth.Config
 func New(config *oauth2.Config, opts ...Option) (*Manager, error) {
-	m, err := applyOpts(&Manager{config: config}, opts...)
+	return newManager(&Manager{config: config}, config.ClientID, opts...)
+}
+
+// newManager applies options to the manager and initialises the cache
+// directory.  id is used to generate the default application name.
+func newManager(m *Manager, id string, opts ...Option) (*Manager, error) {
+	m, err := applyOpts(m, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +108,7 @@ func New(config *oauth2.Config, opts ...Option) (*Manager, error) {
 		m.opts.vendor = defVendor
 	}
 	if m.opts.appname == "" {
-		m.opts.appname = defAppPrefix + m.clientIDhash()
+		m.opts.appname = defAppPrefix + idHash(id)
 	}
 	ucd, err := os.UserCacheDir()
 	if err != nil {
@@ -91,12 +119,75 @@ func New(config *oauth2.Config, opts ...Option) (*Manager, error) {
 	if err := os.MkdirAll(m.cacheDir, 0700); err != nil {
 		return nil, err
 	}
+	switch {
+	case m.store != nil:
+	case m.opts.passphrase != nil:
+		if m.store, err = NewEncryptedFileStore(m.cacheDir, m.opts.passphrase); err != nil {
+			return nil, err
+		}
+	default:
+		m.store = NewFileStore(m.cacheDir)
+	}
+	if m.opts.resetAuth {
+		if err := m.removeToken(); err != nil {
+			return nil, err
+		}
+	}
 
 	return m, nil
 }
 
 // NewFromGoogleCreds creates manager from a credentials file
 func NewFromGoogleCreds(filename string, scopes []string, opts ...Option) (*Manager, error) {
+	b, err := readCredentials(filename)
+	if err != nil {
+		return nil, err
+	}
+	config, err := google.ConfigFromJSON(b, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the client secret file: %s", err)
+	}
+	return New(config, opts...)
+}
+
+// NewFromServiceAccount creates manager from the service account JSON key
+// file.  If subject is not empty, the service account impersonates that
+// user, this requires the domain-wide delegation to be enabled for the
+// service account.  The manager never prompts the user.
+func NewFromServiceAccount(filename string, scopes []string, subject string, opts ...Option) (*Manager, error) {
+	b, err := readCredentials(filename)
+	if err != nil {
+		return nil, err
+	}
+	config, err := google.JWTConfigFromJSON(b, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the service account key file: %s", err)
+	}
+	config.Subject = subject
+	m := &Manager{tokenSource: config.TokenSource(context.Background())}
+	return newManager(m, config.Email+subject, opts...)
+}
+
+// NewFromDefaultCredentials creates manager from the Application Default
+// Credentials, i.e. the file that GOOGLE_APPLICATION_CREDENTIALS environment
+// variable points to, the gcloud credentials, or the metadata server.  If
+// subject is not empty, the service account impersonates that user.  The
+// manager never prompts the user.
+func NewFromDefaultCredentials(scopes []string, subject string, opts ...Option) (*Manager, error) {
+	creds, err := google.FindDefaultCredentialsWithParams(context.Background(), google.CredentialsParams{
+		Scopes:  scopes,
+		Subject: subject,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the default credentials: %s", err)
+	}
+	m := &Manager{tokenSource: creds.TokenSource}
+	return newManager(m, "adc"+creds.ProjectID+subject, opts...)
+}
+
+// readCredentials reads the credentials file, checking its size and
+// permissions.
+func readCredentials(filename string) ([]byte, error) {
 	fi, err := os.Stat(filename)
 	if err != nil {
 		return nil, err
@@ -119,11 +210,7 @@ func NewFromGoogleCreds(filename string, scopes []string, opts ...Option) (*Mana
 	if err != nil {
 		return nil, fmt.Errorf("unable to read the client secret file: %v", err)
 	}
-	config, err := google.ConfigFromJSON(b, scopes...)
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse the client secret file: %s", err)
-	}
-	return New(config, opts...)
+	return b, nil
 }
 
 // NewFromEnv creates manager from environment variables.
@@ -170,33 +257,48 @@ func (m *Manager) setBrowserAuth(enabled bool, listenerAddr, redirectURLBase str
 	}
 }
 
-func (m *Manager) clientIDhash() string {
+// idHash returns the hash of the client ID.
+func idHash(id string) string {
 	h := sha1.New()
-	_, err := io.WriteString(h, m.config.ClientID)
+	_, err := io.WriteString(h, id)
 	if err != nil {
-		panic("clientIDhash: " + err.Error())
+		panic("idHash: " + err.Error())
 	}
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-// Client returns authenticated client.
+// Client returns authenticated client.  The token is saved to the store
+// whenever it is refreshed, and if the refresh token is revoked, the user is
+// asked to authorise again.
 func (m *Manager) Client() (*http.Client, error) {
+	if m.tokenSource != nil {
+		return oauth2.NewClient(context.Background(), m.tokenSource), nil
+	}
 	tok, err := m.Token()
 	if err != nil {
 		return nil, err
 	}
-	return m.Config().Client(context.Background(), tok), nil
+	return oauth2.NewClient(context.Background(), m.newPersistingTokenSource(tok)), nil
 }
 
 // Token return oauth2 token.
 func (m *Manager) Token() (*oauth2.Token, error) {
+	if m.tokenSource != nil {
+		return m.tokenSource.Token()
+	}
 	if m.token != nil {
 		return m.token, nil
 	}
-	// try to load from disk
-	token, err := m.loadToken(filepath.Join(m.cacheDir, m.tokenName()))
+	// try to load from the store
+	token, err := m.loadToken()
 	if err != nil {
+		if !errors.Is(err, ErrNoToken) {
+			return nil, fmt.Errorf("unable to load the token: %w", err)
+		}
 		// try to auth
+		if m.opts.profile != "" {
+			fmt.Printf("Authorizing profile %q\n", m.Profile())
+		}
 		token, err = m.reqFunc()
 		if err != nil {
 			return nil, err
@@ -209,7 +311,15 @@ func (m *Manager) Token() (*oauth2.Token, error) {
 	return token, nil
 }
 
-// Config returns oauth2 config.
+// CacheDir returns the cache directory of the application, where the tokens
+// are stored by default.  Applications can use it to store their own cache
+// files.
+func (m *Manager) CacheDir() string {
+	return m.cacheDir
+}
+
+// Config returns oauth2 config.  It is nil for the service account and
+// default credentials.
 func (m *Manager) Config() *oauth2.Config {
 	return m.config
 }
@@ -0,0 +1,74 @@
+package authmgr
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeServiceAccountKey writes the service account key file with the
+// generated private key and returns its name.
+func writeServiceAccountKey(t *testing.T, perm os.FileMode) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "test-project",
+		"private_key_id": "1",
+		"private_key":    string(keyPEM),
+		"client_email":   "robot@test-project.iam.gserviceaccount.com",
+		"client_id":      "1234",
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "sa.json")
+	if err := os.WriteFile(filename, data, perm); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestNewFromServiceAccount(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	m, err := NewFromServiceAccount(writeServiceAccountKey(t, 0600), []string{"scope"}, "user@example.com", OptAppName("test", "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.tokenSource == nil {
+		t.Error("NewFromServiceAccount() expected the token source to be set")
+	}
+	if m.Config() != nil || m.reqFunc != nil {
+		t.Error("NewFromServiceAccount() must not use the interactive flow")
+	}
+
+	if _, err := NewFromServiceAccount(writeServiceAccountKey(t, 0644), []string{"scope"}, ""); err == nil {
+		t.Error("NewFromServiceAccount() expected an error for the world-readable key file")
+	}
+}
+
+func TestNewFromDefaultCredentials(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", writeServiceAccountKey(t, 0600))
+
+	m, err := NewFromDefaultCredentials([]string{"scope"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.tokenSource == nil || m.reqFunc != nil {
+		t.Error("NewFromDefaultCredentials() expected the non-interactive token source")
+	}
+}
@@ -0,0 +1,198 @@
+package authmgr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// googleDeviceAuthURL is the Google OAuth device authorization endpoint.
+const googleDeviceAuthURL = "https://oauth2.googleapis.com/device/code"
+
+const (
+	deviceGrantType   = "urn:ietf:params:oauth:grant-type:device_code"
+	defDeviceInterval = 5 * time.Second
+)
+
+// device flow errors, as defined in RFC 8628, section 3.5.
+const (
+	errAuthorizationPending = "authorization_pending"
+	errSlowDown             = "slow_down"
+	errAccessDenied         = "access_denied"
+	errExpiredToken         = "expired_token"
+	errInvalidScope         = "invalid_scope"
+)
+
+// ErrDeviceScope is returned if the device authorization server does not
+// allow the requested scopes.  Google allows only a few scopes with the
+// device flow, and Sheets and Drive are not among them.
+var ErrDeviceScope = errors.New("device authorization is not allowed for the requested scopes")
+
+var (
+	errDeviceDenied  = errors.New("authorization request was denied")
+	errDeviceExpired = errors.New("authorization request has expired, please try again")
+)
+
+// deviceCode is the response of the device authorization endpoint.
+type deviceCode struct {
+	DeviceCode string `json:"device_code"`
+	UserCode   string `json:"user_code"`
+	// Google returns verification_url instead of the standard
+	// verification_uri.
+	VerificationURI string `json:"verification_uri"`
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// deviceToken is the response of the token endpoint.
+type deviceToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// deviceTokenRequest requests the token with the OAuth device authorization
+// flow (RFC 8628): it prints the verification URL and the code that the user
+// enters on any device with a browser, and polls for the token.
+func (m *Manager) deviceTokenRequest() (*oauth2.Token, error) {
+	ctx := context.Background()
+	dc, err := m.requestDeviceCode(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request the device code: %w", err)
+	}
+	verificationURI := dc.VerificationURI
+	if verificationURI == "" {
+		verificationURI = dc.VerificationURL
+	}
+	fmt.Printf("To authorize %s, open the following link on any device:\n%s\n\n"+
+		"and enter the code: %s\n\nWaiting for authorization, press [Ctrl]+[C] to cancel...\n",
+		m.opts.appname, verificationURI, dc.UserCode)
+
+	if dc.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(dc.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	interval := time.Duration(dc.Interval) * time.Second
+	if interval <= 0 {
+		interval = defDeviceInterval
+	}
+	return m.pollDeviceToken(ctx, dc.DeviceCode, interval)
+}
+
+// requestDeviceCode requests the device and user codes.
+func (m *Manager) requestDeviceCode(ctx context.Context) (*deviceCode, error) {
+	v := url.Values{
+		"client_id": {m.config.ClientID},
+		"scope":     {strings.Join(m.config.Scopes, " ")},
+	}
+	var dc deviceCode
+	if err := postForm(ctx, m.deviceAuthURL(), v, &dc); err != nil {
+		return nil, err
+	}
+	if dc.Error == errInvalidScope {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceScope, dc.ErrorDescription)
+	}
+	if dc.Error != "" {
+		return nil, fmt.Errorf("%s: %s", dc.Error, dc.ErrorDescription)
+	}
+	if dc.DeviceCode == "" || dc.UserCode == "" {
+		return nil, errors.New("server returned an empty device code")
+	}
+	return &dc, nil
+}
+
+// pollDeviceToken polls the token endpoint until the user authorizes the
+// request, denies it, or the context expires.
+func (m *Manager) pollDeviceToken(ctx context.Context, code string, interval time.Duration) (*oauth2.Token, error) {
+	v := url.Values{
+		"client_id":     {m.config.ClientID},
+		"client_secret": {m.config.ClientSecret},
+		"device_code":   {code},
+		"grant_type":    {deviceGrantType},
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, errDeviceExpired
+			}
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		var tok deviceToken
+		if err := postForm(ctx, m.config.Endpoint.TokenURL, v, &tok); err != nil {
+			return nil, err
+		}
+		switch tok.Error {
+		case "":
+			token := &oauth2.Token{
+				AccessToken:  tok.AccessToken,
+				TokenType:    tok.TokenType,
+				RefreshToken: tok.RefreshToken,
+			}
+			if tok.ExpiresIn > 0 {
+				token.Expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+			}
+			return token, nil
+		case errAuthorizationPending:
+		case errSlowDown:
+			interval += defDeviceInterval
+		case errAccessDenied:
+			return nil, errDeviceDenied
+		case errExpiredToken:
+			return nil, errDeviceExpired
+		default:
+			return nil, fmt.Errorf("token request failed: %s: %s", tok.Error, tok.ErrorDescription)
+		}
+	}
+}
+
+// deviceAuthURL returns the device authorization endpoint.
+func (m *Manager) deviceAuthURL() string {
+	if m.opts.deviceAuthURL != "" {
+		return m.opts.deviceAuthURL
+	}
+	return googleDeviceAuthURL
+}
+
+// postForm posts the form values to the uri and decodes the JSON response
+// into v.  Error responses of the OAuth endpoints are decoded too, so that
+// the caller could check the error code.
+func postForm(ctx context.Context, uri string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("unexpected response (%s): %w", resp.Status, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package authmgr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestManager_deviceFlow(t *testing.T) {
+	var polls int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device/code", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "id" || r.FormValue("scope") != "a b" {
+			t.Errorf("device code request: unexpected form %v", r.Form)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "dev",
+			"user_code":        "ABCD-EFGH",
+			"verification_url": "https://www.google.com/device",
+			"expires_in":       60,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("device_code") != "dev" || r.FormValue("grant_type") != deviceGrantType {
+			t.Errorf("token request: unexpected form %v", r.Form)
+		}
+		if atomic.AddInt32(&polls, 1) < 3 {
+			w.WriteHeader(http.StatusPreconditionRequired)
+			json.NewEncoder(w).Encode(map[string]string{"error": errAuthorizationPending})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	m := &Manager{config: &oauth2.Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Scopes:       []string{"a", "b"},
+		Endpoint:     oauth2.Endpoint{TokenURL: srv.URL + "/token"},
+	}}
+	m.opts.deviceAuthURL = srv.URL + "/device/code"
+
+	ctx := context.Background()
+	dc, err := m.requestDeviceCode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dc.UserCode != "ABCD-EFGH" || dc.VerificationURL == "" {
+		t.Errorf("requestDeviceCode() = %+v", dc)
+	}
+	tok, err := m.pollDeviceToken(ctx, dc.DeviceCode, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" || tok.Expiry.IsZero() || polls != 3 {
+		t.Errorf("pollDeviceToken() = %+v after %d polls", tok, polls)
+	}
+}
+
+func TestManager_pollDeviceToken_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{"denied", errAccessDenied, errDeviceDenied},
+		{"expired", errExpiredToken, errDeviceExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": tt.code})
+			}))
+			defer srv.Close()
+
+			m := &Manager{config: &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}}
+			if _, err := m.pollDeviceToken(context.Background(), "dev", time.Millisecond); err != tt.wantErr {
+				t.Errorf("pollDeviceToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	m := &Manager{config: &oauth2.Config{}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := m.pollDeviceToken(ctx, "dev", time.Hour); err != errDeviceExpired {
+		t.Errorf("pollDeviceToken() error = %v, want %v", err, errDeviceExpired)
+	}
+}
+
+func TestManager_requestDeviceCode_invalidScope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": errInvalidScope, "error_description": "Invalid device flow scope"})
+	}))
+	defer srv.Close()
+
+	m := &Manager{config: &oauth2.Config{ClientID: "id", Scopes: []string{"a"}}}
+	m.opts.deviceAuthURL = srv.URL
+	if _, err := m.requestDeviceCode(context.Background()); !errors.Is(err, ErrDeviceScope) {
+		t.Errorf("requestDeviceCode() error = %v, want %v", err, ErrDeviceScope)
+	}
+}
@@ -0,0 +1,133 @@
+package authmgr
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+)
+
+// encrypted token file format: magic | salt | nonce | ciphertext.
+const (
+	encMagic   = "XTK1"
+	encExt     = ".enc"
+	saltLen    = 16
+	encKeyLen  = 32 // AES-256
+	scryptN    = 1 << 15
+	scryptR    = 8
+	scryptP    = 1
+	minPassLen = 8
+)
+
+var (
+	errShortPassphrase = fmt.Errorf("passphrase must be at least %d characters long", minPassLen)
+	errDecrypt         = errors.New("unable to decrypt the token, wrong passphrase or key file?")
+)
+
+// NewEncryptedFileStore returns the TokenStore that keeps the tokens in the
+// files in the directory, encrypted with AES-GCM, with the key derived from
+// the passphrase.  The passphrase can be the contents of a key file, see
+// ReadKeyFile.
+func NewEncryptedFileStore(dir string, passphrase []byte) (TokenStore, error) {
+	if len(passphrase) < minPassLen {
+		return nil, errShortPassphrase
+	}
+	pass := append([]byte{}, passphrase...)
+	return &fileStore{
+		dir: dir,
+		ext: encExt,
+		encode: func(token *oauth2.Token) ([]byte, error) {
+			data, err := json.Marshal(token)
+			if err != nil {
+				return nil, err
+			}
+			return encrypt(pass, data)
+		},
+		decode: func(data []byte) (*oauth2.Token, error) {
+			plain, err := decrypt(pass, data)
+			if err != nil {
+				return nil, err
+			}
+			var token oauth2.Token
+			if err := json.Unmarshal(plain, &token); err != nil {
+				return nil, err
+			}
+			return &token, nil
+		},
+	}, nil
+}
+
+// ReadKeyFile reads the key file for NewEncryptedFileStore.  As with the
+// credentials file, the key file must not be readable by others.
+func ReadKeyFile(filename string) ([]byte, error) {
+	b, err := readCredentials(filename)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(b), nil
+}
+
+// newGCM derives the key from the passphrase and salt, and returns the
+// AES-GCM cipher.
+func newGCM(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, encKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt encrypts data with the key derived from the passphrase and the
+// random salt.
+func encrypt(passphrase, data []byte) ([]byte, error) {
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(encMagic)+saltLen+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, encMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	// the header is authenticated too.
+	return gcm.Seal(out, nonce, data, out), nil
+}
+
+// decrypt decrypts the data produced by encrypt.
+func decrypt(passphrase, data []byte) ([]byte, error) {
+	if len(data) < len(encMagic)+saltLen || string(data[:len(encMagic)]) != encMagic {
+		return nil, errors.New("not an encrypted token file")
+	}
+	salt := data[len(encMagic) : len(encMagic)+saltLen]
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	hdrLen := len(encMagic) + saltLen + gcm.NonceSize()
+	if len(data) < hdrLen {
+		return nil, errors.New("encrypted token file is truncated")
+	}
+	plain, err := gcm.Open(nil, data[len(encMagic)+saltLen:hdrLen], data[hdrLen:], data[:hdrLen])
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plain, nil
+}
@@ -0,0 +1,203 @@
+package authmgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrKeyNotFound is returned by the Keyring if there is no secret for the
+// service and account.
+var ErrKeyNotFound = errors.New("secret not found in the keyring")
+
+// Keyring is the system keyring, that stores the secrets by the service and
+// account names.
+type Keyring interface {
+	// Get returns the secret, or ErrKeyNotFound.
+	Get(service, account string) (string, error)
+	// Set stores the secret, replacing the existing one.
+	Set(service, account, secret string) error
+	// Delete deletes the secret.  It does nothing if there is no secret.
+	Delete(service, account string) error
+}
+
+const (
+	tokenAccountPrefix = "token:"
+	indexAccount       = "profiles" // the list of profiles that have the token
+)
+
+// keyringStore stores the tokens in the keyring, in JSON format.  The
+// keyring can not list the secrets, so the store keeps the list of profiles
+// as a separate secret.
+type keyringStore struct {
+	service string
+	kr      Keyring
+
+	mu sync.Mutex // guards the index
+}
+
+// NewKeyringStore returns the TokenStore that keeps the tokens in the
+// keyring under the service name, i.e. the application name.  If kr is nil,
+// the Secret Service (GNOME Keyring, KWallet) is used through the
+// secret-tool command.
+func NewKeyringStore(service string, kr Keyring) TokenStore {
+	if kr == nil {
+		kr = secretService{}
+	}
+	return &keyringStore{service: service, kr: kr}
+}
+
+func (ks *keyringStore) Load(profile string) (*oauth2.Token, error) {
+	secret, err := ks.kr.Get(ks.service, tokenAccountPrefix+profile)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, ErrNoToken
+		}
+		return nil, err
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal([]byte(secret), &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (ks *keyringStore) Save(profile string, token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := ks.kr.Set(ks.service, tokenAccountPrefix+profile, string(data)); err != nil {
+		return fmt.Errorf("unable to save the token to the keyring: %w", err)
+	}
+	return ks.updateIndex(profile, true)
+}
+
+func (ks *keyringStore) Delete(profile string) error {
+	if err := ks.kr.Delete(ks.service, tokenAccountPrefix+profile); err != nil {
+		return err
+	}
+	return ks.updateIndex(profile, false)
+}
+
+func (ks *keyringStore) Profiles() ([]string, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.index()
+}
+
+// index returns the list of profiles.
+func (ks *keyringStore) index() ([]string, error) {
+	secret, err := ks.kr.Get(ks.service, indexAccount)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var profiles []string
+	if err := json.Unmarshal([]byte(secret), &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// updateIndex adds the profile to the list of profiles, or removes it.
+func (ks *keyringStore) updateIndex(profile string, add bool) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	profiles, err := ks.index()
+	if err != nil {
+		return err
+	}
+	var updated []string
+	for _, p := range profiles {
+		if p != profile {
+			updated = append(updated, p)
+		}
+	}
+	if add {
+		updated = append(updated, profile)
+	}
+	if len(updated) == 0 {
+		return ks.kr.Delete(ks.service, indexAccount)
+	}
+	sort.Strings(updated)
+	data, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	return ks.kr.Set(ks.service, indexAccount, string(data))
+}
+
+// secretService is the Keyring that uses the Secret Service API through the
+// secret-tool command (libsecret).
+type secretService struct{}
+
+const secretTool = "secret-tool"
+
+func (secretService) check() error {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return fmt.Errorf("keyring is not supported on %s", runtime.GOOS)
+	}
+	if _, err := exec.LookPath(secretTool); err != nil {
+		return fmt.Errorf("keyring requires %s (libsecret-tools): %w", secretTool, err)
+	}
+	return nil
+}
+
+func (ss secretService) Get(service, account string) (string, error) {
+	if err := ss.check(); err != nil {
+		return "", err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(secretTool, "lookup", "service", service, "account", account)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() == 0 {
+			// secret-tool exits with 1 and no message if there is no secret.
+			return "", ErrKeyNotFound
+		}
+		return "", fmt.Errorf("%s lookup: %w: %s", secretTool, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func (ss secretService) Set(service, account, secret string) error {
+	if err := ss.check(); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	// the secret is passed on stdin, so that it is not visible in the process
+	// list.
+	cmd := exec.Command(secretTool, "store", "--label="+service+" "+account, "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s store: %w: %s", secretTool, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (ss secretService) Delete(service, account string) error {
+	if err := ss.check(); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(secretTool, "clear", "service", service, "account", account)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil && stderr.Len() > 0 {
+		// clear exits with 1 if there was nothing to delete.
+		return fmt.Errorf("%s clear: %w: %s", secretTool, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -60,6 +60,17 @@ func OptTryWebAuth(b bool, rootPath string, redirectURLBase string) Option {
 	}
 }
 
+// OptDeviceAuth sets the flag to use the device authorization flow: the user
+// opens the link and enters the code on any device with a browser, and the
+// application polls for the token.  It is suitable for remote machines, and
+// requires the OAuth client of "TVs and Limited Input devices" type.
+func OptDeviceAuth(b bool) Option {
+	return func(m *Manager) error {
+		m.opts.deviceAuth = b
+		return nil
+	}
+}
+
 // OptAppName sets the application name.
 func OptAppName(vendor, name string) Option {
 	return func(m *Manager) error {
@@ -81,6 +92,42 @@ func OptUseIndexPage(b bool) Option {
 // OptResetAuth resets the token and forces reauthentication.
 func OptResetAuth() Option {
 	return func(m *Manager) error {
-		return m.removeToken()
+		m.opts.resetAuth = true
+		return nil
+	}
+}
+
+// OptTokenStore sets the store for the tokens, i.e. NewEncryptedFileStore
+// or NewKeyringStore.  By default, tokens are stored in the cache directory
+// with NewFileStore.
+func OptTokenStore(s TokenStore) Option {
+	return func(m *Manager) error {
+		m.store = s
+		return nil
+	}
+}
+
+// OptEncryptTokens sets the passphrase to encrypt the tokens stored in the
+// cache directory, see NewEncryptedFileStore.
+func OptEncryptTokens(passphrase []byte) Option {
+	return func(m *Manager) error {
+		if len(passphrase) < minPassLen {
+			return errShortPassphrase
+		}
+		m.opts.passphrase = passphrase
+		return nil
+	}
+}
+
+// OptProfile sets the name of the profile, each profile stores its own
+// token, so that the application can use several Google accounts.  Empty
+// name is the default profile.
+func OptProfile(name string) Option {
+	return func(m *Manager) error {
+		if err := validProfile(name); err != nil {
+			return err
+		}
+		m.opts.profile = name
+		return nil
 	}
 }
@@ -0,0 +1,98 @@
+package authmgr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// persistingTokenSource is the oauth2.TokenSource that saves the token to the
+// store whenever it changes, i.e. after the access token is refreshed or the
+// refresh token is rotated.  If the refresh token was revoked or has
+// expired, it requests the new token from the user.
+type persistingTokenSource struct {
+	m *Manager
+
+	mu   sync.Mutex
+	src  oauth2.TokenSource
+	last *oauth2.Token
+}
+
+// newPersistingTokenSource returns the token source that starts with token.
+func (m *Manager) newPersistingTokenSource(token *oauth2.Token) *persistingTokenSource {
+	return &persistingTokenSource{
+		m:    m,
+		src:  m.config.TokenSource(context.Background(), token),
+		last: token,
+	}
+}
+
+func (ts *persistingTokenSource) Token() (*oauth2.Token, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	token, err := ts.src.Token()
+	if err != nil {
+		if !isInvalidGrant(err) {
+			return nil, err
+		}
+		if token, err = ts.reauthorize(); err != nil {
+			return nil, err
+		}
+	}
+	if !sameToken(ts.last, token) {
+		if err := ts.m.saveToken(token); err != nil {
+			// the token is still valid, it will be saved on the next change.
+			log.Printf("failed to save the refreshed token: %s", err)
+		} else {
+			ts.last = token
+		}
+	}
+	return token, nil
+}
+
+// reauthorize requests the new token from the user, after the refresh token
+// was rejected.
+func (ts *persistingTokenSource) reauthorize() (*oauth2.Token, error) {
+	fmt.Printf("The stored authorization of profile %q has been revoked or has expired, please authorize again.\n", ts.m.Profile())
+	if err := ts.m.removeToken(); err != nil {
+		return nil, err
+	}
+	token, err := ts.m.reqFunc()
+	if err != nil {
+		return nil, fmt.Errorf("profile %q: authorization was revoked or has expired: %w", ts.m.Profile(), err)
+	}
+	ts.src = ts.m.config.TokenSource(context.Background(), token)
+	ts.last = nil // save it
+	return token, nil
+}
+
+// sameToken returns true if the tokens are the same.
+func sameToken(a, b *oauth2.Token) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.AccessToken == b.AccessToken && a.RefreshToken == b.RefreshToken && a.Expiry.Equal(b.Expiry)
+}
+
+// isInvalidGrant returns true if the token endpoint rejected the refresh
+// token (RFC 6749, section 5.2), i.e. it was revoked by the user or has
+// expired.
+func isInvalidGrant(err error) bool {
+	var re *oauth2.RetrieveError
+	if !errors.As(err, &re) {
+		return false
+	}
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(re.Body, &resp); err != nil {
+		return false
+	}
+	return resp.Error == "invalid_grant"
+}
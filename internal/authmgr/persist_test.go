@@ -0,0 +1,88 @@
+package authmgr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func Test_persistingTokenSource(t *testing.T) {
+	revoked := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if revoked {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"access2","refresh_token":"refresh2","token_type":"Bearer","expires_in":1}`)
+	}))
+	defer srv.Close()
+
+	store := NewFileStore(t.TempDir())
+	m := &Manager{
+		config: &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL}},
+		store:  store,
+		reqFunc: func() (*oauth2.Token, error) {
+			return &oauth2.Token{AccessToken: "access3", RefreshToken: "refresh3", Expiry: time.Now().Add(time.Hour)}, nil
+		},
+	}
+	expired := &oauth2.Token{AccessToken: "access1", RefreshToken: "refresh1", Expiry: time.Now().Add(-time.Hour)}
+	if err := m.saveToken(expired); err != nil {
+		t.Fatal(err)
+	}
+	ts := m.newPersistingTokenSource(expired)
+
+	// refreshed and rotated token is saved.
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := store.Load(DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "access2" || saved.AccessToken != "access2" || saved.RefreshToken != "refresh2" {
+		t.Errorf("Token() = %v, saved %v, want the refreshed token", tok, saved)
+	}
+
+	// revoked refresh token starts the authorization.
+	revoked = true
+	// the refreshed token expires in 1 second, and oauth2 refreshes the
+	// tokens 10 seconds before they expire.
+	tok, err = ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved, err = store.Load(DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "access3" || saved.RefreshToken != "refresh3" {
+		t.Errorf("Token() = %v, saved %v, want the new token", tok, saved)
+	}
+}
+
+func Test_isInvalidGrant(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"invalid grant", &oauth2.RetrieveError{Body: []byte(`{"error":"invalid_grant"}`)}, true},
+		{"wrapped", fmt.Errorf("get: %w", &oauth2.RetrieveError{Body: []byte(`{"error":"invalid_grant"}`)}), true},
+		{"invalid client", &oauth2.RetrieveError{Body: []byte(`{"error":"invalid_client"}`)}, false},
+		{"not json", &oauth2.RetrieveError{Body: []byte(`Internal Server Error`)}, false},
+		{"other", fmt.Errorf("connection refused"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isInvalidGrant(tt.err); got != tt.want {
+				t.Errorf("isInvalidGrant() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package authmgr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// stateTTL is the lifetime of the authorization request: the user must
+	// complete the login within this time.
+	stateTTL = 10 * time.Minute
+	// stateLen is the length of the state string.
+	stateLen = 32
+	// verifierLen is the length of the PKCE code verifier, RFC 7636 requires
+	// 43 to 128 characters.
+	verifierLen = 64
+)
+
+var (
+	errStateUnknown = errors.New("unknown or already used authorization request, please start the login again")
+	errStateExpired = errors.New("authorization request has expired, please start the login again")
+)
+
+// authRequest is the pending authorization request.  State protects the
+// callback from the forged requests, and the PKCE code verifier (RFC 7636)
+// binds the authorization code to the application that requested it.
+type authRequest struct {
+	state    string
+	verifier string
+	expires  time.Time
+}
+
+// newAuthRequest creates the authorization request with a fresh state and
+// code verifier.
+func newAuthRequest() *authRequest {
+	return &authRequest{
+		state:    randString(stateLen),
+		verifier: randString(verifierLen),
+		expires:  time.Now().Add(stateTTL),
+	}
+}
+
+// challenge returns the S256 code challenge for the verifier.
+func (r *authRequest) challenge() string {
+	sum := sha256.Sum256([]byte(r.verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authCodeURL returns the URL of the consent page for the request.
+func (r *authRequest) authCodeURL(config *oauth2.Config, opts ...oauth2.AuthCodeOption) string {
+	opts = append(opts,
+		oauth2.SetAuthURLParam("code_challenge", r.challenge()),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	return config.AuthCodeURL(r.state, opts...)
+}
+
+// exchange converts the authorization code into the token, sending the code
+// verifier.
+func (r *authRequest) exchange(ctx context.Context, config *oauth2.Config, code string) (*oauth2.Token, error) {
+	return config.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", r.verifier))
+}
+
+// authRequests holds the pending authorization requests of the browser flow.
+// Each state can be used only once.
+type authRequests struct {
+	mu      sync.Mutex
+	pending map[string]*authRequest
+}
+
+// add adds the request, and forgets the expired ones.
+func (a *authRequests) add(r *authRequest) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending == nil {
+		a.pending = make(map[string]*authRequest)
+	}
+	now := time.Now()
+	for state, p := range a.pending {
+		if now.After(p.expires) {
+			delete(a.pending, state)
+		}
+	}
+	a.pending[r.state] = r
+}
+
+// take returns the request for the state and removes it, so that the state
+// can not be replayed.
+func (a *authRequests) take(state string, now time.Time) (*authRequest, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r, ok := a.pending[state]
+	if !ok || state == "" {
+		return nil, errStateUnknown
+	}
+	delete(a.pending, state)
+	if now.After(r.expires) {
+		return nil, errStateExpired
+	}
+	return r, nil
+}
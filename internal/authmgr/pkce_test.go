@@ -0,0 +1,114 @@
+package authmgr
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func Test_authRequest_challenge(t *testing.T) {
+	// RFC 7636, Appendix B.
+	r := &authRequest{verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+	if got, want := r.challenge(), "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("authRequest.challenge() = %q, want %q", got, want)
+	}
+}
+
+func Test_authRequests_take(t *testing.T) {
+	var a authRequests
+	r1, r2 := newAuthRequest(), newAuthRequest()
+	if r1.state == r2.state || r1.verifier == r2.verifier {
+		t.Fatal("newAuthRequest() expected a fresh state and verifier")
+	}
+	a.add(r1)
+	a.add(r2)
+
+	if got, err := a.take(r1.state, time.Now()); err != nil || got != r1 {
+		t.Errorf("take() = %v, %v, want %v", got, err, r1)
+	}
+	if _, err := a.take(r1.state, time.Now()); err != errStateUnknown {
+		t.Errorf("take() replayed state error = %v, want %v", err, errStateUnknown)
+	}
+	if _, err := a.take(r2.state, time.Now().Add(stateTTL+time.Second)); err != errStateExpired {
+		t.Errorf("take() expired state error = %v, want %v", err, errStateExpired)
+	}
+	if _, err := a.take("", time.Now()); err != errStateUnknown {
+		t.Errorf("take() empty state error = %v, want %v", err, errStateUnknown)
+	}
+}
+
+func TestManager_callbackHandler(t *testing.T) {
+	var gotVerifier string
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotVerifier = r.FormValue("code_verifier")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokenSrv.Close()
+
+	m := &Manager{
+		config: &oauth2.Config{
+			ClientID: "id",
+			Endpoint: oauth2.Endpoint{AuthURL: "https://auth.example.com/", TokenURL: tokenSrv.URL},
+		},
+		opts: options{webRootPath: "/", appname: "test"},
+	}
+	tokenC := make(chan *oauth2.Token, 1)
+	srv := httptest.NewServer(m.Handlers(tokenC))
+	defer srv.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// login redirects to the consent page with the state and the challenge.
+	resp, err := client.Get(srv.URL + m.loginPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := loc.Query()
+	state := q.Get("state")
+	if state == "" || q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("login redirect: unexpected consent URL %s", loc)
+	}
+
+	callback := srv.URL + m.callbackPath() + "?code=code&state=" + url.QueryEscape(state)
+	resp, err = client.Get(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("callback: unexpected status %s", resp.Status)
+	}
+	if tok := <-tokenC; tok.AccessToken != "access" {
+		t.Errorf("callback: unexpected token %v", tok)
+	}
+	if len(gotVerifier) != verifierLen {
+		t.Errorf("callback: expected the code verifier in the exchange, got %q", gotVerifier)
+	}
+
+	// replayed state is rejected with the error page.
+	resp, err = client.Get(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), errStateUnknown.Error()) {
+		t.Errorf("callback: replayed state: status %s, body %q", resp.Status, body)
+	}
+}
@@ -0,0 +1,93 @@
+package authmgr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DefaultProfile is the name of the default profile.
+const DefaultProfile = "default"
+
+// googleRevokeURL is the Google OAuth token revocation endpoint.
+const googleRevokeURL = "https://oauth2.googleapis.com/revoke"
+
+const (
+	tokenPrefix = "auth-token"
+	tokenExt    = ".bin"
+)
+
+var profileRe = regexp.MustCompile(`^[-\w]+$`)
+
+// validProfile returns an error if the profile name can not be used in the
+// token file name.
+func validProfile(name string) error {
+	if name == "" || profileRe.MatchString(name) {
+		return nil
+	}
+	return fmt.Errorf("invalid profile name %q: only letters, digits, '-' and '_' are allowed", name)
+}
+
+// Profile returns the profile name of the manager.
+func (m *Manager) Profile() string {
+	if m.opts.profile == "" {
+		return DefaultProfile
+	}
+	return m.opts.profile
+}
+
+// Profiles returns the sorted names of the profiles that have the stored
+// token.
+func (m *Manager) Profiles() ([]string, error) {
+	return m.store.Profiles()
+}
+
+// Revoke revokes the stored token of the profile with the authorization
+// server, so that the application loses access to the account, and deletes
+// it from the store.  The token is deleted even if the revocation fails.
+func (m *Manager) Revoke() error {
+	token, err := m.loadToken()
+	if err != nil {
+		return err
+	}
+	m.token = nil
+	defer m.removeToken()
+
+	tok := token.RefreshToken
+	if tok == "" {
+		tok = token.AccessToken
+	}
+	return revokeToken(context.Background(), m.revokeURL(), tok)
+}
+
+// revokeURL returns the token revocation endpoint.
+func (m *Manager) revokeURL() string {
+	if m.opts.revokeURL != "" {
+		return m.opts.revokeURL
+	}
+	return googleRevokeURL
+}
+
+// revokeToken revokes the token (RFC 7009).
+func revokeToken(ctx context.Context, uri string, token string) error {
+	form := url.Values{"token": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unable to revoke the token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
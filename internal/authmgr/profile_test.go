@@ -0,0 +1,80 @@
+package authmgr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/oauth2"
+)
+
+func Test_fileStore_Profiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"auth-token.bin", "auth-token.work.bin", "auth-token.home.bin", "auth-tokenx.bin", "state.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := NewFileStore(dir).Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"default", "home", "work"}, got); diff != "" {
+		t.Errorf("fileStore.Profiles() (-want,+got):\n%s", diff)
+	}
+}
+
+func Test_fileStore_filename(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    string
+	}{
+		{"", "auth-token.bin"},
+		{DefaultProfile, "auth-token.bin"},
+		{"work", "auth-token.work.bin"},
+	}
+	fs := &fileStore{ext: tokenExt}
+	for _, tt := range tests {
+		if got := fs.filename(tt.profile); got != tt.want {
+			t.Errorf("fileStore.filename() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestOptProfile(t *testing.T) {
+	if err := OptProfile("work_1")(&Manager{}); err != nil {
+		t.Errorf("OptProfile() unexpected error: %s", err)
+	}
+	if err := OptProfile("../token")(&Manager{}); err == nil {
+		t.Error("OptProfile() expected an error for the invalid name")
+	}
+}
+
+func TestManager_Revoke(t *testing.T) {
+	var revoked string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		revoked = r.FormValue("token")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	m := &Manager{store: NewFileStore(dir), opts: options{profile: "work", revokeURL: srv.URL}}
+	if err := m.Revoke(); err != ErrNoToken {
+		t.Errorf("Manager.Revoke() error = %v, want %v", err, ErrNoToken)
+	}
+	if err := m.saveToken(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Revoke(); err != nil {
+		t.Fatal(err)
+	}
+	if revoked != "refresh" {
+		t.Errorf("Manager.Revoke() revoked %q, want the refresh token", revoked)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "auth-token.work.bin")); !os.IsNotExist(err) {
+		t.Error("Manager.Revoke() expected the token file to be removed")
+	}
+}
@@ -1,23 +1,35 @@
 package authmgr
 
 import (
-	"math/rand"
+	"crypto/rand"
 	"strings"
-	"time"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 const chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
-// randString generates a random string with length of `n`.
+// maxByte is the largest multiple of len(chars) that fits in a byte, random
+// bytes above it are discarded, so that all characters are equally likely.
+const maxByte = 256 - 256%len(chars)
+
+// randString generates a cryptographically secure random string with length
+// of `n`.
 func randString(n int) string {
 	var sb strings.Builder
 	sb.Grow(n)
-	for i := n - 1; i >= 0; i-- {
-		sb.WriteByte(chars[rand.Intn(len(chars))])
+	buf := make([]byte, n)
+	for sb.Len() < n {
+		if _, err := rand.Read(buf); err != nil {
+			panic("authmgr: unable to read random bytes: " + err.Error())
+		}
+		for _, b := range buf {
+			if int(b) >= maxByte {
+				continue
+			}
+			sb.WriteByte(chars[int(b)%len(chars)])
+			if sb.Len() == n {
+				break
+			}
+		}
 	}
 	return sb.String()
 }
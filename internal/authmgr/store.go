@@ -0,0 +1,157 @@
+package authmgr
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoToken is returned by the TokenStore if the profile has no stored
+// token.
+var ErrNoToken = errors.New("profile has no stored token")
+
+// TokenStore stores the OAuth tokens of the profiles.
+type TokenStore interface {
+	// Load returns the token of the profile, or ErrNoToken.
+	Load(profile string) (*oauth2.Token, error)
+	// Save saves the token of the profile, replacing the existing one.
+	Save(profile string, token *oauth2.Token) error
+	// Delete deletes the token of the profile.  It does nothing if the
+	// profile has no token.
+	Delete(profile string) error
+	// Profiles returns the sorted names of the profiles that have the
+	// stored token.
+	Profiles() ([]string, error)
+}
+
+// fileStore stores each token in its own file in the directory.  Files are
+// encoded with encode and decoded with decode.
+type fileStore struct {
+	dir    string
+	ext    string
+	encode func(*oauth2.Token) ([]byte, error)
+	decode func([]byte) (*oauth2.Token, error)
+}
+
+// NewFileStore returns the TokenStore that keeps the tokens in the gob
+// files in the directory, this is the default store of the Manager.
+func NewFileStore(dir string) TokenStore {
+	return &fileStore{dir: dir, ext: tokenExt, encode: encodeGob, decode: decodeGob}
+}
+
+// filename returns the token file name of the profile.
+func (fs *fileStore) filename(profile string) string {
+	if profile == "" || profile == DefaultProfile {
+		return tokenPrefix + fs.ext
+	}
+	return tokenPrefix + "." + profile + fs.ext
+}
+
+func (fs *fileStore) Load(profile string) (*oauth2.Token, error) {
+	data, err := os.ReadFile(filepath.Join(fs.dir, fs.filename(profile)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoToken
+		}
+		return nil, err
+	}
+	return fs.decode(data)
+}
+
+func (fs *fileStore) Save(profile string, token *oauth2.Token) error {
+	data, err := fs.encode(token)
+	if err != nil {
+		return err
+	}
+	fullPath := filepath.Join(fs.dir, fs.filename(profile))
+	log.Printf("Saving token file to: %s", fullPath)
+	if err := os.WriteFile(fullPath, data, 0600); err != nil {
+		return fmt.Errorf("unable to cache oauth token: %v", err)
+	}
+	return nil
+}
+
+func (fs *fileStore) Delete(profile string) error {
+	if err := os.Remove(filepath.Join(fs.dir, fs.filename(profile))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (fs *fileStore) Profiles() ([]string, error) {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasPrefix(name, tokenPrefix) || !strings.HasSuffix(name, fs.ext) {
+			continue
+		}
+		profile := strings.TrimSuffix(strings.TrimPrefix(name, tokenPrefix), fs.ext)
+		switch {
+		case profile == "":
+			profile = DefaultProfile
+		case profile[0] == '.' && validProfile(profile[1:]) == nil:
+			profile = profile[1:]
+		default:
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+func encodeGob(token *oauth2.Token) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(token); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeGob(data []byte) (*oauth2.Token, error) {
+	token := &oauth2.Token{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ExportToken writes the stored token of the profile to w in JSON format,
+// i.e. to move it to another machine.
+func (m *Manager) ExportToken(w io.Writer) error {
+	token, err := m.loadToken()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(token)
+}
+
+// ImportToken reads the token in JSON format from r, and stores it as the
+// token of the profile.
+func (m *Manager) ImportToken(r io.Reader) error {
+	var token oauth2.Token
+	if err := json.NewDecoder(io.LimitReader(r, maxCredFileSz)).Decode(&token); err != nil {
+		return fmt.Errorf("unable to parse the token: %w", err)
+	}
+	if token.AccessToken == "" && token.RefreshToken == "" {
+		return errors.New("token has neither access nor refresh token")
+	}
+	m.token = nil
+	return m.saveToken(&token)
+}
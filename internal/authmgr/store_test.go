@@ -0,0 +1,155 @@
+package authmgr
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/oauth2"
+)
+
+// fakeKeyring is the in-memory Keyring.
+type fakeKeyring map[string]string
+
+func (fk fakeKeyring) Get(service, account string) (string, error) {
+	secret, ok := fk[service+"/"+account]
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	return secret, nil
+}
+
+func (fk fakeKeyring) Set(service, account, secret string) error {
+	fk[service+"/"+account] = secret
+	return nil
+}
+
+func (fk fakeKeyring) Delete(service, account string) error {
+	delete(fk, service+"/"+account)
+	return nil
+}
+
+var testToken = &oauth2.Token{
+	AccessToken:  "access",
+	TokenType:    "Bearer",
+	RefreshToken: "refresh",
+	Expiry:       time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+// testStore checks that the store saves, loads, lists and deletes the
+// tokens.
+func testStore(t *testing.T, s TokenStore) {
+	t.Helper()
+	if _, err := s.Load(DefaultProfile); err != ErrNoToken {
+		t.Errorf("Load() error = %v, want %v", err, ErrNoToken)
+	}
+	for _, profile := range []string{"work", DefaultProfile} {
+		if err := s.Save(profile, testToken); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := s.Load("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(testToken, got, cmp.AllowUnexported(oauth2.Token{})); diff != "" {
+		t.Errorf("Load() (-want,+got):\n%s", diff)
+	}
+	profiles, err := s.Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{DefaultProfile, "work"}, profiles); diff != "" {
+		t.Errorf("Profiles() (-want,+got):\n%s", diff)
+	}
+	if err := s.Delete("work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("work"); err != nil {
+		t.Errorf("Delete() of the deleted token: unexpected error: %s", err)
+	}
+	if _, err := s.Load("work"); err != ErrNoToken {
+		t.Errorf("Load() of the deleted token error = %v, want %v", err, ErrNoToken)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, NewFileStore(t.TempDir()))
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewEncryptedFileStore(dir, []byte("correct horse battery staple"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	data, err := os.ReadFile(filepath.Join(dir, "auth-token.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("refresh")) {
+		t.Error("encrypted file store: token is stored in plain text")
+	}
+
+	wrong, err := NewEncryptedFileStore(dir, []byte("wrong passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Load(DefaultProfile); err != errDecrypt {
+		t.Errorf("Load() with the wrong passphrase error = %v, want %v", err, errDecrypt)
+	}
+
+	if _, err := NewEncryptedFileStore(dir, []byte("short")); err != errShortPassphrase {
+		t.Errorf("NewEncryptedFileStore() error = %v, want %v", err, errShortPassphrase)
+	}
+}
+
+func TestKeyringStore(t *testing.T) {
+	kr := fakeKeyring{}
+	testStore(t, NewKeyringStore("sheets-refresh", kr))
+	if _, ok := kr["sheets-refresh/token:default"]; !ok {
+		t.Error("keyring store: expected the token in the keyring")
+	}
+	if err := NewKeyringStore("sheets-refresh", kr).Delete(DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+	if len(kr) != 0 {
+		t.Errorf("keyring store: unexpected secrets left: %v", kr)
+	}
+}
+
+func TestManager_ExportImportToken(t *testing.T) {
+	src := &Manager{store: NewFileStore(t.TempDir())}
+	if err := src.saveToken(testToken); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := src.ExportToken(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"refresh_token": "refresh"`) {
+		t.Errorf("ExportToken() unexpected output: %s", buf.String())
+	}
+
+	dst := &Manager{store: NewKeyringStore("test", fakeKeyring{}), opts: options{profile: "work"}}
+	if err := dst.ImportToken(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dst.loadToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RefreshToken != testToken.RefreshToken || !got.Expiry.Equal(testToken.Expiry) {
+		t.Errorf("ImportToken() imported %v, want %v", got, testToken)
+	}
+
+	if err := dst.ImportToken(strings.NewReader(`{}`)); err == nil {
+		t.Error("ImportToken() expected an error for the empty token")
+	}
+}
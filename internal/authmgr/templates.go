@@ -9,6 +9,7 @@ var tmpl *template.Template
 func init() {
 	tmpl = template.Must(template.New(tmIndex).Parse(index))
 	template.Must(tmpl.New(tmCallback).Parse(success))
+	template.Must(tmpl.New(tmError).Parse(failure))
 }
 
 const (
@@ -154,6 +155,42 @@ const (
 		src="https://cdnjs.cloudflare.com/ajax/libs/materialize/0.97.5/js/materialize.min.js"></script>
 </body>
 
+</html>
+`
+
+	failure = `
+<html>
+
+<head>
+	<link rel="stylesheet" type="text/css"
+		  href="https://cdnjs.cloudflare.com/ajax/libs/materialize/0.97.5/css/materialize.min.css">
+</head>
+
+<body>
+<div class="section"></div>
+<main>
+	<center>
+		<div class="section"></div>
+		<div class="container">
+			<div class="z-depth-1 grey lighten-4 row"
+				 style="display: inline-block; padding: 32px 48px 32px 48px; border: 1px solid #EEE;">
+
+				<div class='row'>
+					<div class='col s12'>
+					Failed to authorise <b>{{.AppName}}</b>: {{.Error}}
+					</div>
+				</div>
+
+				<div class='row'>
+					<a href="{{.LoginPath}}">Login with Google</a>
+				</div>
+
+			</div>
+		</div>
+	</center>
+</main>
+</body>
+
 </html>
 `
 )
@@ -2,13 +2,12 @@ package authmgr
 
 import (
 	"context"
-	"encoding/gob"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"path"
-	"path/filepath"
+	"time"
 
 	"golang.org/x/oauth2"
 )
@@ -17,6 +16,7 @@ import (
 const (
 	tmCallback = "callback.html"
 	tmIndex    = "index.html"
+	tmError    = "error.html"
 
 	basepath  = "/"
 	pLogin    = "login"
@@ -26,59 +26,33 @@ const (
 type appInfoPage struct {
 	AppName   string
 	LoginPath string
+	Error     string
 }
 
-var oauthStateString = randString(16)
-
-// removeToken finds and removes tokenFile from cache folder.  If the token
-// file is not present it does nothing.
+// removeToken removes the token of the profile from the token store.  If
+// there is no token it does nothing.
 func (m *Manager) removeToken() error {
-	tokenPath := filepath.Join(m.cacheDir, m.tokenName())
-	if tokenPath == "" {
-		return nil
-	}
-	if err := os.Remove(tokenPath); err != nil && !os.IsNotExist(err) {
-		return err
-	}
-	return nil
+	return m.store.Delete(m.Profile())
 }
 
 //
 // Token request and manipulation
 //
 
-// loadToken creates a new token manager from token file.
-func (m *Manager) loadToken(tokenPath string) (*oauth2.Token, error) {
-	f, err := os.Open(tokenPath)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	token := &oauth2.Token{}
-	if err := gob.NewDecoder(f).Decode(token); err != nil {
-		return nil, err
-	}
-
-	return token, nil
+// loadToken loads the token of the profile from the token store.
+func (m *Manager) loadToken() (*oauth2.Token, error) {
+	return m.store.Load(m.Profile())
 }
 
-// saveToken saves the token to file.
+// saveToken saves the token of the profile to the token store.
 func (m *Manager) saveToken(token *oauth2.Token) error {
-	fullPath := filepath.Join(m.cacheDir, m.tokenName())
-
-	log.Printf("Saving token file to: %s", fullPath)
-	f, err := os.OpenFile(fullPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		return fmt.Errorf("unable to cache oauth token: %v", err)
-	}
-	defer f.Close()
-	return gob.NewEncoder(f).Encode(token)
+	return m.store.Save(m.Profile(), token)
 }
 
 // cliTokenRequest does the auth exchange using current terminal.
 func (m *Manager) cliTokenRequest() (*oauth2.Token, error) {
-	authURL := m.Config().AuthCodeURL("state-token", oauth2.AccessTypeOffline)
+	req := newAuthRequest()
+	authURL := req.authCodeURL(m.Config(), oauth2.AccessTypeOffline)
 	fmt.Printf("Go to the following link in your browser:\n%v\n\n"+
 		"Enter authorization code: ", authURL)
 
@@ -87,7 +61,7 @@ func (m *Manager) cliTokenRequest() (*oauth2.Token, error) {
 		return nil, fmt.Errorf("unable to read authorization code: %v", err)
 	}
 
-	tok, err := m.Config().Exchange(context.TODO(), authCode)
+	tok, err := req.exchange(context.TODO(), m.Config(), authCode)
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve token from web: %v", err)
 	}
@@ -135,6 +109,8 @@ func (m *Manager) browserTokenRequest() (*oauth2.Token, error) {
 
 // Handlers registers authentication handling routes.
 func (m *Manager) Handlers(tokenChan chan<- *oauth2.Token) http.Handler {
+	m.requests = new(authRequests)
+
 	mux := http.NewServeMux()
 
 	mux.HandleFunc(m.opts.webRootPath, m.rootHandler)
@@ -157,31 +133,45 @@ func (m *Manager) rootHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, pLogin, http.StatusTemporaryRedirect)
 		return
 	}
-	if err := tmpl.ExecuteTemplate(w, tmIndex, appInfoPage{m.opts.appname, m.loginPath()}); err != nil {
+	if err := tmpl.ExecuteTemplate(w, tmIndex, appInfoPage{AppName: m.opts.appname, LoginPath: m.loginPath()}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
 func (m *Manager) loginHandler(w http.ResponseWriter, r *http.Request) {
-	authURL := m.Config().AuthCodeURL(oauthStateString)
-	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+	req := newAuthRequest()
+	m.requests.add(req)
+	http.Redirect(w, r, req.authCodeURL(m.Config()), http.StatusTemporaryRedirect)
+}
+
+// errorPage renders the error page with the link to start the login again.
+func (m *Manager) errorPage(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	if err := tmpl.ExecuteTemplate(w, tmError, appInfoPage{m.opts.appname, m.loginPath(), err.Error()}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 func (m *Manager) createCallbackHandler(tokenChan chan<- *oauth2.Token) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		state := r.FormValue("state")
-		if state != oauthStateString {
-			log.Printf("invalid oauth state, expected '%s', got '%s'\n", oauthStateString, state)
-			http.Redirect(w, r, basepath, http.StatusTemporaryRedirect)
+		req, err := m.requests.take(r.FormValue("state"), time.Now())
+		if err != nil {
+			log.Printf("invalid oauth state: %s", err)
+			m.errorPage(w, http.StatusBadRequest, err)
+			return
+		}
+		if e := r.FormValue("error"); e != "" {
+			log.Printf("authorization failed: %s", e)
+			m.errorPage(w, http.StatusForbidden, fmt.Errorf("authorization failed: %s", e))
 			return
 		}
 
 		// code exchange
 		code := r.FormValue("code")
-		token, err := m.Config().Exchange(context.Background(), code)
+		token, err := req.exchange(context.Background(), m.Config(), code)
 		if err != nil {
 			fmt.Printf("Code exchange failed with '%s'\n", err)
-			http.Redirect(w, r, basepath, http.StatusTemporaryRedirect)
+			m.errorPage(w, http.StatusBadGateway, errors.New("code exchange failed, please start the login again"))
 			return
 		}
 
@@ -197,8 +187,3 @@ func (m *Manager) createCallbackHandler(tokenChan chan<- *oauth2.Token) http.Han
 		}
 	}
 }
-
-// tokenName returns the token name.
-func (m *Manager) tokenName() string {
-	return "auth-token.bin"
-}
@@ -0,0 +1,254 @@
+package xls2sheets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Journal records the temporary files on Google Drive, so that the files
+// left by the crashed run could be deleted on the next start.  The file is
+// recorded before it is uploaded, and removed from the journal once it is
+// deleted.  Every change is written to disk immediately.
+type Journal struct {
+	filename string
+
+	mu      sync.Mutex
+	entries []*JournalEntry
+}
+
+// JournalEntry is the temporary file recorded in the journal.
+type JournalEntry struct {
+	// Name is the name of the temporary file.
+	Name string `json:"name"`
+	// ID is the Drive file ID, it is empty if the program has crashed
+	// before the upload has finished, then the file is looked up by name.
+	ID string `json:"id,omitempty"`
+	// Profile is the auth profile that has uploaded the file.
+	Profile string `json:"profile,omitempty"`
+	// Folder is the ID of the Drive folder of the file, if it was not
+	// uploaded to My Drive root.
+	Folder string `json:"folder,omitempty"`
+	// Created is the time the entry was created.
+	Created time.Time `json:"created"`
+}
+
+// journalKey is the context key for the journal of the task.
+type journalKey struct{}
+
+// taskJournal is the journal, and the profile of the task source.
+type taskJournal struct {
+	jr      *Journal
+	profile string
+}
+
+// OpenJournal opens the journal file.  If the file does not exist, the
+// empty journal is returned, the file is created on the first change.
+func OpenJournal(filename string) (*Journal, error) {
+	jr := &Journal{filename: filename}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return jr, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &jr.entries); err != nil {
+		return nil, fmt.Errorf("journal %s: %w", filename, err)
+	}
+	return jr, nil
+}
+
+// Entries returns the files recorded in the journal.
+func (jr *Journal) Entries() []JournalEntry {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	entries := make([]JournalEntry, len(jr.entries))
+	for i, e := range jr.entries {
+		entries[i] = *e
+	}
+	return entries
+}
+
+// add records the file with the name, that is about to be uploaded to the
+// folder.
+func (jr *Journal) add(name, profile, folder string) (*JournalEntry, error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	e := &JournalEntry{Name: name, Profile: profile, Folder: folder, Created: time.Now().UTC()}
+	jr.entries = append(jr.entries, e)
+	if err := jr.save(); err != nil {
+		jr.entries = jr.entries[:len(jr.entries)-1]
+		return nil, err
+	}
+	return e, nil
+}
+
+// setID records the Drive file ID of the uploaded file.
+func (jr *Journal) setID(e *JournalEntry, id string) error {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	e.ID = id
+	return jr.save()
+}
+
+// remove removes the entry of the deleted file.
+func (jr *Journal) remove(e *JournalEntry) error {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	for i := range jr.entries {
+		if jr.entries[i] == e {
+			jr.entries = append(jr.entries[:i], jr.entries[i+1:]...)
+			return jr.save()
+		}
+	}
+	return nil
+}
+
+// forget removes the entry of the file with the id, i.e. if it was deleted,
+// or is left on purpose.
+func (jr *Journal) forget(id string) error {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	for i, e := range jr.entries {
+		if e.ID == id {
+			jr.entries = append(jr.entries[:i], jr.entries[i+1:]...)
+			return jr.save()
+		}
+	}
+	return nil
+}
+
+// save writes the journal to disk, it must be called with the lock held.
+func (jr *Journal) save() error {
+	if len(jr.entries) == 0 {
+		if err := os.Remove(jr.filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(jr.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(jr.filename, data)
+}
+
+// purge deletes the files left in the journal by the previous run.  Entries
+// of the profiles without the client are kept in the journal.  It returns the
+// error if any of the files could not be deleted.
+func (jr *Journal) purge(ctx context.Context, clients profileClients) error {
+	jr.mu.Lock()
+	entries := make([]*JournalEntry, len(jr.entries))
+	copy(entries, jr.entries)
+	jr.mu.Unlock()
+
+	var failed int
+	for _, e := range entries {
+		client, ok := clients[e.Profile]
+		if !ok {
+			log.Printf("  * %s: no client for profile %q, skipping", e.Name, e.Profile)
+			failed++
+			continue
+		}
+		log.Printf("  * deleting the leftover temporary file %s", e.Name)
+		if err := deleteLeftover(ctx, client, *e); err != nil {
+			log.Printf("    * failed: %s", err)
+			failed++
+			continue
+		}
+		if err := jr.remove(e); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d leftover temporary files could not be deleted", failed, len(entries))
+	}
+	return nil
+}
+
+// purgeJournal deletes the temporary files left by the previous run, if the
+// job has the journal.  Errors are logged, they do not fail the job.
+func (j *Job) purgeJournal(ctx context.Context, clients profileClients) {
+	if j.Journal == nil || len(j.Journal.Entries()) == 0 {
+		return
+	}
+	log.Printf("deleting the temporary files left by the previous run")
+	if err := j.Journal.purge(ctx, clients); err != nil {
+		log.Printf("failed to delete the temporary files: %s", err)
+	}
+}
+
+// deleteLeftover deletes the file of the journal entry.  If the upload has
+// not finished, the ID is not known, and the files with the entry name are
+// deleted.
+func deleteLeftover(ctx context.Context, client *http.Client, e JournalEntry) error {
+	srv, err := drive.New(client)
+	if err != nil {
+		return err
+	}
+	ids := []string{e.ID}
+	if e.ID == "" {
+		q := fmt.Sprintf("name = '%s' and %s and trashed = false", strings.ReplaceAll(e.Name, "'", `\'`), ownerQuery(e.Folder))
+		var fl *drive.FileList
+		if err := retry(ctx, func() (err error) {
+			fl, err = listAllDrives(srv.Files.List(), e.Folder).Q(q).Fields("files(id)").Context(ctx).Do()
+			return err
+		}); err != nil {
+			return err
+		}
+		ids = ids[:0]
+		for _, f := range fl.Files {
+			ids = append(ids, f.Id)
+		}
+	}
+	for _, id := range ids {
+		err := retry(ctx, func() error {
+			return srv.Files.Delete(id).SupportsAllDrives(true).Context(ctx).Do()
+		})
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+			continue // already deleted.
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withJournal returns the context that carries the journal and the profile
+// of the task source.
+func withJournal(ctx context.Context, jr *Journal, profile string) context.Context {
+	if jr == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, journalKey{}, taskJournal{jr: jr, profile: profile})
+}
+
+// journalFrom returns the journal and the profile from the context, or nil.
+func journalFrom(ctx context.Context) (*Journal, string) {
+	tj, _ := ctx.Value(journalKey{}).(taskJournal)
+	return tj.jr, tj.profile
+}
+
+// detached is the context that carries the values of the parent context,
+// but is never cancelled, so that the cleanup could be done after the task
+// context was cancelled.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
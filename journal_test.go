@@ -0,0 +1,173 @@
+package xls2sheets
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// nameQueryRe extracts the file name from the Drive query.
+var nameQueryRe = regexp.MustCompile(`name = '([^']*)'`)
+
+// journalDrive is the fake Drive API, that creates, finds and deletes files.
+type journalDrive struct {
+	mu      sync.Mutex
+	created []string          // names
+	deleted []string          // ids
+	names   map[string]string // ids by name, for lookups
+	// upload is the query and body of the last upload request.
+	uploadQuery url.Values
+	uploadBody  string
+}
+
+func (fd *journalDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/drive/v3/files":
+		fd.created = append(fd.created, "new")
+		body, _ := io.ReadAll(r.Body)
+		fd.uploadQuery, fd.uploadBody = r.URL.Query(), string(body)
+		json.NewEncoder(w).Encode(map[string]string{"id": "new"})
+	case r.Method == http.MethodGet && r.URL.Path == "/drive/v3/files":
+		files := []map[string]string{}
+		if m := nameQueryRe.FindStringSubmatch(r.FormValue("q")); m != nil {
+			if id, ok := fd.names[m[1]]; ok {
+				files = append(files, map[string]string{"id": id})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+	case r.Method == http.MethodDelete:
+		id := strings.TrimPrefix(r.URL.Path, "/drive/v3/files/")
+		if id == "gone" {
+			http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+			return
+		}
+		fd.deleted = append(fd.deleted, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "journal", "job.json")
+	jr, err := OpenJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := &journalDrive{}
+	client := apiClient(t, fd)
+	ctx = withJournal(ctx, jr, "work")
+
+	id, err := upload(ctx, client, strings.NewReader("a,b\n"), "data.csv", generateName(tempFilePrefix, ".csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the upload is recorded on disk.
+	reopened, err := OpenJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := reopened.Entries()
+	if len(entries) != 1 || entries[0].ID != id || entries[0].Profile != "work" || !strings.HasPrefix(entries[0].Name, tempFilePrefix) {
+		t.Fatalf("OpenJournal() entries = %+v, want the uploaded file", entries)
+	}
+
+	sf := &Source{fileID: id}
+	if err := sf.DeleteContext(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if got := jr.Entries(); len(got) != 0 {
+		t.Errorf("Entries() = %+v, want none after delete", got)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("empty journal file must be removed, stat error: %v", err)
+	}
+}
+
+func TestJournal_purge(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "job.json")
+	jr, err := OpenJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []JournalEntry{
+		{Name: "uploaded", ID: "uploaded-id"},
+		{Name: "lost"},                                // crashed during the upload
+		{Name: "deleted", ID: "gone"},                 // already deleted
+		{Name: "other", ID: "other-id", Profile: "x"}, // no client
+	} {
+		entry, err := jr.add(e.Name, e.Profile, e.Folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.ID != "" {
+			if err := jr.setID(entry, e.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	fd := &journalDrive{names: map[string]string{"lost": "lost-id"}}
+	if err := jr.purge(ctx, profileClients{"": apiClient(t, fd)}); err == nil {
+		t.Error("purge() must fail for the profile without the client")
+	}
+	if diff := cmp.Diff([]string{"uploaded-id", "lost-id"}, fd.deleted); diff != "" {
+		t.Errorf("deleted (-want,+got):\n%s", diff)
+	}
+	reopened, err := OpenJournal(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []JournalEntry{{Name: "other", ID: "other-id", Profile: "x"}}
+	if diff := cmp.Diff(want, reopened.Entries(), cmpopts.IgnoreFields(JournalEntry{}, "Created")); diff != "" {
+		t.Errorf("Entries() (-want,+got):\n%s", diff)
+	}
+}
+
+func TestDetached(t *testing.T) {
+	ctx, cancel := context.WithCancel(withJournal(context.Background(), &Journal{}, "p"))
+	cancel()
+	d := detached{ctx}
+	if d.Err() != nil {
+		t.Errorf("detached.Err() = %v, want nil", d.Err())
+	}
+	if jr, profile := journalFrom(d); jr == nil || profile != "p" {
+		t.Error("detached context must keep the values")
+	}
+}
+
+func TestJournal_purgeNameCollision(t *testing.T) {
+	// the entry without the ID must not match the live temporary file of
+	// another task, uploaded within the same second.
+	ctx := context.Background()
+	jr, err := OpenJournal(filepath.Join(t.TempDir(), "job.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed, live := generateName(tempFilePrefix, ".csv"), generateName(tempFilePrefix, ".csv")
+	if _, err := jr.add(crashed, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	fd := &journalDrive{names: map[string]string{crashed: "crashed-id", live: "live-id"}}
+	if err := jr.purge(ctx, profileClients{"": apiClient(t, fd)}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"crashed-id"}, fd.deleted); diff != "" {
+		t.Errorf("deleted (-want,+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,305 @@
+package xls2sheets
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// local file extensions that can be read without converting them on google
+// drive.
+const (
+	extXLSX = ".xlsx"
+	extODS  = ".ods"
+)
+
+var errNoSheets = errors.New("workbook does not contain any worksheets")
+
+// sheetReader is the interface for reading values from the source
+// spreadsheet.  It is implemented by sheetSvc for Google Spreadsheets, and by
+// workbook for files that are read locally.
+type sheetReader interface {
+	// get returns the values within the range, the range is in A1 notation.
+	get(ctx context.Context, Range string) (*sheets.ValueRange, error)
+	// titles returns the titles of all worksheets in the order they appear
+	// in the spreadsheet.
+	titles(ctx context.Context) ([]string, error)
+}
+
+// workbook is the in-memory representation of the locally read spreadsheet
+// file.
+type workbook struct {
+	sheets []*worksheet
+}
+
+// worksheet is a single sheet of the workbook.  Rows are stored as they
+// were read from the file, trailing empty cells and rows are not stored.
+type worksheet struct {
+	title string
+	rows  [][]string
+}
+
+// readWorkbook reads the workbook from r, the format is determined by
+// extension ext.  title is used as the worksheet name for formats that do not
+// have one, i.e. csv.
+func readWorkbook(r io.Reader, ext string, title string) (*workbook, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(ext) {
+	case extCSV:
+		return readCSV(bytes.NewReader(data), title)
+	case extXLSX:
+		return readXLSX(bytes.NewReader(data), int64(len(data)))
+	case extODS:
+		return readODS(bytes.NewReader(data), int64(len(data)))
+	}
+	return nil, fmt.Errorf("unsupported file type for local processing: %q", ext)
+}
+
+// readCSV reads the csv file into a workbook with a single worksheet.
+func readCSV(r io.Reader, title string) (*workbook, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // rows may have different number of fields.
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	ws := &worksheet{title: title}
+	for i, rec := range records {
+		ws.setRow(i, rec)
+	}
+	return &workbook{sheets: []*worksheet{ws}}, nil
+}
+
+// sheet returns the worksheet with the title.
+func (wb *workbook) sheet(title string) (*worksheet, bool) {
+	for _, ws := range wb.sheets {
+		if ws.title == title {
+			return ws, true
+		}
+	}
+	return nil, false
+}
+
+// titles returns the titles of all worksheets.
+func (wb *workbook) titles(context.Context) ([]string, error) {
+	titles := make([]string, len(wb.sheets))
+	for i, ws := range wb.sheets {
+		titles[i] = ws.title
+	}
+	return titles, nil
+}
+
+// get returns the values within the range.  The behaviour mimics the
+// Spreadsheets.Values.Get: trailing empty rows and columns are omitted.
+func (wb *workbook) get(_ context.Context, Range string) (*sheets.ValueRange, error) {
+	if len(wb.sheets) == 0 {
+		return nil, errNoSheets
+	}
+	rng, err := parseA1(Range)
+	if err != nil {
+		return nil, err
+	}
+	ws, ok := wb.sheet(rng.sheet)
+	if !ok && rng.sheet != "" && !strings.Contains(Range, "!") {
+		// not a sheet name, could be a range within the first sheet.
+		if rng, err = parseA1("!" + Range); err != nil {
+			return nil, fmt.Errorf("unable to parse range: %s", Range)
+		}
+	}
+	if rng.sheet == "" {
+		// no sheet name, the first sheet is assumed.
+		ws, ok = wb.sheets[0], true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unable to parse range: %s", Range)
+	}
+	return &sheets.ValueRange{
+		MajorDimension: "ROWS",
+		Range:          Range,
+		Values:         ws.values(rng),
+	}, nil
+}
+
+// values returns the values within the range.
+func (ws *worksheet) values(rng a1Range) [][]interface{} {
+	var values [][]interface{}
+	for r := rng.startRow; r < len(ws.rows) && (rng.endRow < 0 || r <= rng.endRow); r++ {
+		row := ws.rows[r]
+		vals := []interface{}{}
+		for c := rng.startCol; c < len(row) && (rng.endCol < 0 || c <= rng.endCol); c++ {
+			vals = append(vals, row[c])
+		}
+		values = append(values, trimRow(vals))
+	}
+	// trimming trailing empty rows
+	for len(values) > 0 && len(values[len(values)-1]) == 0 {
+		values = values[:len(values)-1]
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// setRow sets the row at index idx to vals.  Trailing empty values are
+// trimmed, and empty rows are not stored.
+func (ws *worksheet) setRow(idx int, vals []string) {
+	for len(vals) > 0 && vals[len(vals)-1] == "" {
+		vals = vals[:len(vals)-1]
+	}
+	if len(vals) == 0 {
+		return
+	}
+	for len(ws.rows) <= idx {
+		ws.rows = append(ws.rows, nil)
+	}
+	ws.rows[idx] = vals
+}
+
+// trimRow trims the trailing empty values.
+func trimRow(vals []interface{}) []interface{} {
+	for len(vals) > 0 && vals[len(vals)-1] == "" {
+		vals = vals[:len(vals)-1]
+	}
+	return vals
+}
+
+// a1Range is the parsed A1 notation range.  Row and column indexes are zero
+// based, end indexes are inclusive and are set to -1 if the range is not
+// bounded.
+type a1Range struct {
+	sheet    string
+	startCol int
+	startRow int
+	endCol   int
+	endRow   int
+}
+
+// parseA1 parses the range in A1 notation, i.e. "Sheet1!A1:B2", "Data!A3:U",
+// "'My Sheet'!C:C" or "Sheet1".  A string without the exclamation mark is
+// treated as a sheet name, it is up to the caller to decide if it is a range
+// within the default sheet.
+func parseA1(s string) (a1Range, error) {
+	rng := a1Range{endCol: -1, endRow: -1}
+	if s == "" {
+		return rng, errors.New("empty range")
+	}
+	rng.sheet = sheetName(s)
+	sep := strings.LastIndex(s, "!")
+	if sep < 0 {
+		return rng, nil
+	}
+	cells := strings.SplitN(s[sep+1:], ":", 2)
+	startCol, startRow, err := parseCell(cells[0])
+	if err != nil {
+		return rng, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	if startCol >= 0 {
+		rng.startCol = startCol
+	}
+	if startRow >= 0 {
+		rng.startRow = startRow
+	}
+	if len(cells) == 1 {
+		// single cell
+		rng.endCol, rng.endRow = startCol, startRow
+		return rng, nil
+	}
+	if rng.endCol, rng.endRow, err = parseCell(cells[1]); err != nil {
+		return rng, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	return rng, nil
+}
+
+// unquoteSheet removes the quotes around the sheet name, if any.
+func unquoteSheet(s string) string {
+	if len(s) > 1 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// quoteSheet quotes the sheet name so that it can be used in the A1
+// notation.
+func quoteSheet(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sheetName returns the sheet name from the address in A1 notation.
+func sheetName(address string) string {
+	if sep := strings.LastIndex(address, "!"); sep >= 0 {
+		address = address[:sep]
+	}
+	return unquoteSheet(address)
+}
+
+// firstRowRange returns the range of the whole first row of the address,
+// i.e. for "Data!B4:D" it returns "'Data'!4:4".
+func firstRowRange(address string) (string, error) {
+	rng, err := parseA1(address)
+	if err != nil {
+		return "", err
+	}
+	row := strconv.Itoa(rng.startRow + 1)
+	if rng.sheet == "" {
+		return row + ":" + row, nil
+	}
+	return quoteSheet(rng.sheet) + "!" + row + ":" + row, nil
+}
+
+// parseCell parses the cell reference, i.e. "B12", and returns zero-based
+// column and row indexes.  Either of column or row may be omitted, i.e. "B"
+// or "12", in this case the index of the missing part is -1.
+func parseCell(s string) (col, row int, err error) {
+	s = strings.ToUpper(strings.ReplaceAll(s, "$", ""))
+	if s == "" {
+		return -1, -1, errors.New("empty cell reference")
+	}
+	i := 0
+	for i < len(s) && 'A' <= s[i] && s[i] <= 'Z' {
+		i++
+	}
+	col = -1
+	if i > 0 {
+		col = colIndex(s[:i])
+	}
+	row = -1
+	if i < len(s) {
+		n, err := strconv.Atoi(s[i:])
+		if err != nil || n < 1 {
+			return -1, -1, fmt.Errorf("invalid cell reference: %q", s)
+		}
+		row = n - 1
+	}
+	return col, row, nil
+}
+
+// colIndex converts the column letters to zero-based index, i.e. "A" is 0,
+// "AA" is 26.
+func colIndex(s string) int {
+	n := 0
+	for _, c := range s {
+		n = n*26 + int(c-'A') + 1
+	}
+	return n - 1
+}
+
+// colName converts the zero-based column index to column letters, i.e. 0 is
+// "A", 26 is "AA".
+func colName(idx int) string {
+	var name []byte
+	for idx++; idx > 0; idx = (idx - 1) / 26 {
+		name = append([]byte{byte('A' + (idx-1)%26)}, name...)
+	}
+	return string(name)
+}
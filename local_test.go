@@ -0,0 +1,137 @@
+package xls2sheets
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// makeZip creates an in-memory zip archive with files.
+func makeZip(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func Test_parseA1(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    a1Range
+		wantErr bool
+	}{
+		{"sheet only", "Data", a1Range{sheet: "Data", endCol: -1, endRow: -1}, false},
+		{"full range", "Data!A3:U10", a1Range{sheet: "Data", startRow: 2, endCol: 20, endRow: 9}, false},
+		{"open rows", "Data!A3:U", a1Range{sheet: "Data", startRow: 2, endCol: 20, endRow: -1}, false},
+		{"columns", "'My Sheet'!C:D", a1Range{sheet: "My Sheet", startCol: 2, endCol: 3, endRow: -1}, false},
+		{"rows", "Sheet1!2:5", a1Range{sheet: "Sheet1", startRow: 1, endCol: -1, endRow: 4}, false},
+		{"single cell", "Sheet1!$B$2", a1Range{sheet: "Sheet1", startCol: 1, startRow: 1, endCol: 1, endRow: 1}, false},
+		{"no sheet", "!AA1:AB2", a1Range{startCol: 26, endCol: 27, endRow: 1}, false},
+		{"quoted quote", "'Bob''s'!A1:A", a1Range{sheet: "Bob's", endCol: 0, endRow: -1}, false},
+		{"empty", "", a1Range{endCol: -1, endRow: -1}, true},
+		{"invalid row", "Data!A0", a1Range{sheet: "Data", endCol: -1, endRow: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseA1(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseA1() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(a1Range{})); diff != "" {
+				t.Errorf("parseA1() mismatch (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_workbook_get(t *testing.T) {
+	wb, err := readCSV(strings.NewReader("a,b,c\n1,2,3\n,,\n4,,6,\n"), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		rng     string
+		want    [][]interface{}
+		wantErr bool
+	}{
+		{"whole sheet", "csv", [][]interface{}{{"a", "b", "c"}, {"1", "2", "3"}, {}, {"4", "", "6"}}, false},
+		{"subrange", "csv!B2:C", [][]interface{}{{"2", "3"}, {}, {"", "6"}}, false},
+		{"trailing empty trimmed", "csv!B3:B4", nil, false},
+		{"outside", "csv!Z1:Z", nil, false},
+		{"no sheet name", "A1:A2", [][]interface{}{{"a"}, {"1"}}, false},
+		{"unknown sheet", "Nope!A1", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := wb.get(context.Background(), tt.rng)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("workbook.get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, got.Values); diff != "" {
+				t.Errorf("workbook.get() mismatch (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_firstRowRange(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{"History", "'History'!1:1", false},
+		{"Daily Rates!B4:D", "'Daily Rates'!4:4", false},
+		{"!C3", "3:3", false},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := firstRowRange(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("firstRowRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("firstRowRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_colName(t *testing.T) {
+	for _, name := range []string{"A", "Z", "AA", "AZ", "BA", "ZZ", "AAA", "XFD"} {
+		if got := colName(colIndex(name)); got != name {
+			t.Errorf("colName(colIndex(%q)) = %q", name, got)
+		}
+	}
+}
+
+func Test_readWorkbook_unsupported(t *testing.T) {
+	if _, err := readWorkbook(strings.NewReader(""), ".xls", ""); err == nil {
+		t.Error("readWorkbook() expected an error for xls")
+	}
+}
@@ -0,0 +1,236 @@
+package xls2sheets
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const odsContent = "content.xml"
+
+// ods cell value types.
+const (
+	odsTypeFloat      = "float"
+	odsTypePercentage = "percentage"
+	odsTypeCurrency   = "currency"
+	odsTypeDate       = "date"
+	odsTypeTime       = "time"
+	odsTypeBoolean    = "boolean"
+)
+
+// readODS reads the OpenDocument spreadsheet.  Cells are read as their
+// values, dates are converted to ISO format.
+func readODS(r io.ReaderAt, size int64) (*workbook, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	var content *zip.File
+	for _, f := range zr.File {
+		if f.Name == odsContent {
+			content = f
+			break
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("ods: %s not found", odsContent)
+	}
+	rc, err := content.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var wb workbook
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("ods: %w", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "table" {
+			continue
+		}
+		ws, err := readODSTable(dec, se)
+		if err != nil {
+			return nil, fmt.Errorf("ods: %w", err)
+		}
+		wb.sheets = append(wb.sheets, ws)
+	}
+	if len(wb.sheets) == 0 {
+		return nil, errNoSheets
+	}
+	return &wb, nil
+}
+
+// readODSTable reads the table:table element.  Repeated rows and cells are
+// expanded, unless they are empty.
+func readODSTable(dec *xml.Decoder, start xml.StartElement) (*worksheet, error) {
+	ws := &worksheet{title: attr(start, "name")}
+	rowIdx := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "table" {
+				return ws, nil
+			}
+		case xml.StartElement:
+			if t.Name.Local != "table-row" {
+				continue
+			}
+			vals, err := readODSRow(dec)
+			if err != nil {
+				return nil, err
+			}
+			repeat := repeated(t, "number-rows-repeated")
+			if len(vals) == 0 {
+				rowIdx += repeat
+				continue
+			}
+			for i := 0; i < repeat; i++ {
+				ws.setRow(rowIdx, vals)
+				rowIdx++
+			}
+		}
+	}
+}
+
+// readODSRow reads cells of the table:table-row.
+func readODSRow(dec *xml.Decoder) ([]string, error) {
+	var vals []string
+	pending := 0 // number of empty cells that were not added yet.
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "table-row" {
+				return vals, nil
+			}
+		case xml.StartElement:
+			if t.Name.Local != "table-cell" && t.Name.Local != "covered-table-cell" {
+				continue
+			}
+			val, err := readODSCell(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			repeat := repeated(t, "number-columns-repeated")
+			if val == "" {
+				pending += repeat
+				continue
+			}
+			for ; pending > 0; pending-- {
+				vals = append(vals, "")
+			}
+			for i := 0; i < repeat; i++ {
+				vals = append(vals, val)
+			}
+		}
+	}
+}
+
+// readODSCell reads the value of the table cell.
+func readODSCell(dec *xml.Decoder, start xml.StartElement) (string, error) {
+	text, err := readODSText(dec, start.Name.Local)
+	if err != nil {
+		return "", err
+	}
+	switch attr(start, "value-type") {
+	case odsTypeFloat, odsTypePercentage, odsTypeCurrency:
+		return attr(start, "value"), nil
+	case odsTypeDate:
+		return strings.Replace(attr(start, "date-value"), "T", " ", 1), nil
+	case odsTypeTime:
+		return odsTime(attr(start, "time-value")), nil
+	case odsTypeBoolean:
+		return strings.ToUpper(attr(start, "boolean-value")), nil
+	}
+	return text, nil
+}
+
+// readODSText reads the text content of the element until its end.
+// Paragraphs are separated by the new line.
+func readODSText(dec *xml.Decoder, end string) (string, error) {
+	var sb strings.Builder
+	paragraphs, inPara := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			switch t.Name.Local {
+			case end:
+				return sb.String(), nil
+			case "p":
+				inPara--
+			}
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				if paragraphs > 0 {
+					sb.WriteByte('\n')
+				}
+				paragraphs++
+				inPara++
+			case "s":
+				sb.WriteString(strings.Repeat(" ", repeated(t, "c")))
+			case "tab":
+				sb.WriteByte('\t')
+			case "line-break":
+				sb.WriteByte('\n')
+			case "annotation":
+				// comments are not part of the value.
+				if err := dec.Skip(); err != nil {
+					return "", err
+				}
+			}
+		case xml.CharData:
+			if inPara > 0 {
+				sb.Write(t)
+			}
+		}
+	}
+}
+
+// odsTime converts the ISO 8601 duration, i.e. "PT10H30M00S", to time.
+func odsTime(s string) string {
+	var h, m, sec float64
+	if _, err := fmt.Sscanf(s, "PT%fH%fM%fS", &h, &m, &sec); err != nil {
+		return s
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", int(h), int(m), int(sec))
+}
+
+// attr returns the value of the attribute with the local name.
+func attr(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// repeated returns the value of repeat attribute, or 1, if it's not set.
+func repeated(se xml.StartElement, name string) int {
+	n, err := strconv.Atoi(attr(se, name))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
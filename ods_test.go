@@ -0,0 +1,63 @@
+package xls2sheets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testODSContent = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet>
+<table:table table:name="Rates">
+<table:table-column table:number-columns-repeated="3"/>
+<table:table-row>
+<table:table-cell office:value-type="string"><text:p>Date</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>Two<text:s text:c="2"/>spaces</text:p><text:p>line</text:p></table:table-cell>
+<table:table-cell table:number-columns-repeated="1000"/>
+</table:table-row>
+<table:table-row table:number-rows-repeated="2"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+<table:table-row>
+<table:table-cell office:value-type="date" office:date-value="2020-01-02T10:00:00"/>
+<table:table-cell table:number-columns-repeated="2"/>
+<table:table-cell office:value-type="float" office:value="1.25" table:number-columns-repeated="2"><text:p>1.3</text:p></table:table-cell>
+<table:table-cell office:value-type="boolean" office:boolean-value="true"><text:p>TRUE</text:p></table:table-cell>
+<table:table-cell office:value-type="time" office:time-value="PT13H05M00S"/>
+</table:table-row>
+<table:table-row table:number-rows-repeated="1048000"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table>
+<table:table table:name="Second"><table:table-row><table:table-cell office:value-type="string"><text:p>x</text:p><office:annotation><text:p>comment</text:p></office:annotation></table:table-cell></table:table-row></table:table>
+</office:spreadsheet></office:body>
+</office:document-content>`
+
+func Test_readODS(t *testing.T) {
+	r := makeZip(t, map[string]string{odsContent: testODSContent})
+	wb, err := readODS(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wb.sheets) != 2 {
+		t.Fatalf("expected 2 sheets, got %d", len(wb.sheets))
+	}
+	got, err := wb.get(context.Background(), "Rates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]interface{}{
+		{"Date", "Two  spaces\nline"},
+		{},
+		{},
+		{"2020-01-02 10:00:00", "", "", "1.25", "1.25", "TRUE", "13:05:00"},
+	}
+	if diff := cmp.Diff(want, got.Values); diff != "" {
+		t.Errorf("readODS() mismatch (-want,+got):\n%s", diff)
+	}
+	second, err := wb.get(context.Background(), "Second!A1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([][]interface{}{{"x"}}, second.Values); diff != "" {
+		t.Errorf("readODS() mismatch (-want,+got):\n%s", diff)
+	}
+}
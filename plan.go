@@ -0,0 +1,377 @@
+package xls2sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TaskPlan describes the changes that the task would make to the target.
+type TaskPlan struct {
+	Name          string
+	SpreadsheetID string
+	// CreateSheets are the titles of the sheets that would be created.
+	CreateSheets []string
+	// Ranges are the changes to each of the target ranges.
+	Ranges []*RangePlan
+	// Export is the local file that the spreadsheet would be exported to,
+	// and ExportExists is true if it would be overwritten.
+	Export       string
+	ExportExists bool
+	// Err is the error that occurred while planning the task.
+	Err error
+}
+
+// RangePlan describes the changes to a single target range.
+type RangePlan struct {
+	Source string
+	Target string
+	Mode   string
+	// Clear is true if the target range would be cleared.
+	Clear bool
+	// CopySheet is true if the copy of the source sheet would be pasted
+	// into the target sheet (copy_sheet), and ReplaceSheet is true if the
+	// target sheet would be replaced with the copy (replace_sheet).
+	CopySheet    bool
+	ReplaceSheet bool
+	// Cells is the number of cells that would change.
+	Cells int
+	// Updated, Added and Deleted are the number of rows that would be
+	// changed in upsert mode.
+	Updated int
+	Added   int
+	Deleted int
+}
+
+// String returns the human readable description of the plan.
+func (p *TaskPlan) String() string {
+	var sb strings.Builder
+	if p.Err != nil {
+		fmt.Fprintf(&sb, "task %q: error: %s\n", p.Name, p.Err)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "task %q: spreadsheet %s\n", p.Name, p.SpreadsheetID)
+	for _, title := range p.CreateSheets {
+		fmt.Fprintf(&sb, "  + create sheet %q\n", title)
+	}
+	for _, r := range p.Ranges {
+		fmt.Fprintf(&sb, "  * %q -> %q: ", r.Source, r.Target)
+		if r.ReplaceSheet {
+			sb.WriteString("replace sheet\n")
+			continue
+		}
+		if r.CopySheet {
+			sb.WriteString("copy sheet\n")
+			continue
+		}
+		if r.Clear {
+			sb.WriteString("clear, ")
+		}
+		switch r.Mode {
+		case ModeAppend:
+			fmt.Fprintf(&sb, "append %d cells\n", r.Cells)
+		case ModeUpsert:
+			fmt.Fprintf(&sb, "%d rows updated, %d rows added, %d rows deleted, %d cells changed\n", r.Updated, r.Added, r.Deleted, r.Cells)
+		default:
+			fmt.Fprintf(&sb, "%d cells changed\n", r.Cells)
+		}
+	}
+	if p.Export != "" {
+		if p.ExportExists {
+			fmt.Fprintf(&sb, "  * export to %s: overwrite, backup to %s\n", p.Export, p.Export+bakSuffix)
+		} else {
+			fmt.Fprintf(&sb, "  * export to %s: new file\n", p.Export)
+		}
+	}
+	return sb.String()
+}
+
+// Plan reads the sources of all tasks and compares them with the current
+// contents of the targets, without changing the targets.  Sources that are
+// not read locally are still converted to the temporary spreadsheets, which
+// are deleted afterwards.  Tasks are planned independently, so the changes
+// made by the tasks they depend on are not taken into account.  If any of the
+// tasks could not be planned, it returns *JobError along with the plans.
+func (j *Job) Plan(client *http.Client) ([]*TaskPlan, error) {
+	return j.PlanContext(context.Background(), client)
+}
+
+// PlanContext is the same as Plan, but accepts the context.  The files left
+// in the Journal by the previous run are not deleted.
+func (j *Job) PlanContext(ctx context.Context, client *http.Client) ([]*TaskPlan, error) {
+	if err := j.validate(); err != nil {
+		return nil, err
+	}
+	ctx = withTempFolder(withRetryPolicy(ctx, j.Retry), j.TempFolderID)
+	clients, err := j.clients(client)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]*TaskPlan, 0, len(j.Tasks))
+	jobErr := &JobError{Total: len(j.Tasks), Errors: make(map[string]error)}
+	for _, name := range j.TaskNames() {
+		if ctx.Err() != nil {
+			jobErr.Errors[name] = errAborted
+			jobErr.Aborted = true
+			continue
+		}
+		log.Printf("planning task: %q", name)
+		task := j.Tasks[name]
+		plan, err := task.plan(withJournal(ctx, j.Journal, task.sourceProfile()), clients.source(task), clients.target(task))
+		if err != nil {
+			plan = &TaskPlan{Err: err}
+			jobErr.Errors[name] = err
+		}
+		plan.Name = name
+		plans = append(plans, plan)
+	}
+	if len(jobErr.Errors) > 0 {
+		return plans, jobErr
+	}
+	return plans, nil
+}
+
+// plan reads the source with src client and returns the changes that the
+// task would make to the target, read with trg client.
+func (task *Task) plan(ctx context.Context, src, trg *http.Client) (*TaskPlan, error) {
+	if task.Source == nil || task.Target == nil {
+		return nil, errors.New("task must have both source and target")
+	}
+	if task.Source.Local {
+		wb, err := task.Source.load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return task.Target.plan(ctx, trg, wb, task.Source.SheetAddressRange)
+	}
+	ctx = withTempFolder(ctx, task.TempFolderID)
+	tempSpreadsheetID, err := task.Source.ProcessContext(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	if task.LeaveJunk {
+		task.keepJunk(ctx, tempSpreadsheetID)
+	} else {
+		defer task.cleanup(ctx, src)
+	}
+	sourcer, err := newSheetSvc(src, tempSpreadsheetID)
+	if err != nil {
+		return nil, err
+	}
+	return task.Target.plan(ctx, trg, sourcer, task.Source.SheetAddressRange)
+}
+
+// plan compares the values read from sourcer with the current contents of
+// the target and returns the changes that update would make.
+func (trg *Target) plan(ctx context.Context, client *http.Client, sourcer sheetReader, srcAddressRange []string) (*TaskPlan, error) {
+	if err := trg.validateMode(); err != nil {
+		return nil, err
+	}
+	srcAddressRange, trgAddress, err := resolveRanges(ctx, sourcer, srcAddressRange, trg.SheetAddress)
+	if err != nil {
+		return nil, err
+	}
+	copier, err := trg.copier(sourcer, srcAddressRange, trgAddress)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newSheetSvc(client, trg.SpreadsheetID)
+	if err != nil {
+		return nil, err
+	}
+	reader.opts = trg.valueOptions()
+	sourcer = withValueOptions(sourcer, reader.opts)
+	titles, err := reader.titles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &TaskPlan{SpreadsheetID: trg.SpreadsheetID}
+
+	// existing contains the values of the target sheets, starting at A1,
+	// sheets that would be created are empty.
+	existing := make(map[string][][]interface{}, len(trgAddress))
+	for _, address := range trgAddress {
+		title := sheetName(address)
+		if _, seen := existing[title]; seen || contains(titles, title) {
+			continue
+		}
+		if !trg.Create {
+			return nil, fmt.Errorf("address %q referencing nonexisting sheet - create it and restart", address)
+		}
+		p.CreateSheets = append(p.CreateSheets, title)
+		existing[title] = nil
+	}
+
+	for i := range srcAddressRange {
+		if copier != nil {
+			// the whole sheet is overwritten with the copy.
+			p.Ranges = append(p.Ranges, &RangePlan{Source: srcAddressRange[i], Target: trgAddress[i], CopySheet: !trg.ReplaceSheet, ReplaceSheet: trg.ReplaceSheet})
+			continue
+		}
+		values, err := sourcer.get(ctx, srcAddressRange[i])
+		if err != nil {
+			return nil, err
+		}
+		rng, err := parseA1(trgAddress[i])
+		if err != nil {
+			return nil, err
+		}
+		current, seen := existing[rng.sheet]
+		if !seen {
+			vr, err := reader.get(ctx, quoteSheet(rng.sheet))
+			if err != nil {
+				return nil, err
+			}
+			current = vr.Values
+			existing[rng.sheet] = current
+		}
+
+		rp := &RangePlan{
+			Source: srcAddressRange[i],
+			Target: trgAddress[i],
+			Mode:   trg.Mode,
+			Clear:  trg.Clear,
+		}
+		switch trg.Mode {
+		case ModeAppend:
+			src := values.Values
+			if trg.Clear {
+				current = nil
+			}
+			if trg.SkipHeader && len(src) > 0 && rng.startRow < len(current) && countCells(current[rng.startRow:rng.startRow+1]) > 0 {
+				src = src[1:]
+			}
+			rp.Cells = countCells(src)
+		case ModeUpsert:
+			keys, err := keyIndexes(trg.KeyColumns, rng.startCol)
+			if err != nil {
+				return nil, err
+			}
+			var raw [][]interface{}
+			if contains(titles, rng.sheet) {
+				vr, err := withValueOptions(reader, unformatted).get(ctx, quoteSheet(rng.sheet))
+				if err != nil {
+					return nil, err
+				}
+				raw = vr.Values
+			}
+			m, err := mergeRows(rng.sheet, current, raw, values.Values, rng.startRow, rng.startCol, keys, trg.DeleteMissing)
+			if err != nil {
+				return nil, err
+			}
+			rp.Updated, rp.Added, rp.Deleted = len(m.updates)-m.appended, m.appended, len(m.deleted)
+			if rp.Cells, err = upsertChanges(current, raw, m); err != nil {
+				return nil, err
+			}
+		default:
+			rp.Cells = overwriteChanges(current, values.Values, rng, trg.Clear)
+		}
+		p.Ranges = append(p.Ranges, rp)
+	}
+
+	if location := os.ExpandEnv(trg.Location); location != "" {
+		p.Export = location
+		if _, err := os.Stat(location); err == nil {
+			p.ExportExists = true
+		}
+	}
+	return p, nil
+}
+
+// overwriteChanges returns the number of cells that would change if src was
+// written at the start of rng.  existing are the current values of the
+// sheet, starting at A1.  If clear is true, the cells within rng that are
+// not overwritten are cleared.
+func overwriteChanges(existing, src [][]interface{}, rng a1Range, clear bool) int {
+	changed := 0
+	for r, row := range src {
+		for c, v := range row {
+			if fmt.Sprint(v) != cellValue(existing, rng.startRow+r, rng.startCol+c) {
+				changed++
+			}
+		}
+	}
+	if !clear {
+		return changed
+	}
+	for r, row := range existing {
+		for c, v := range row {
+			if fmt.Sprint(v) == "" || !rng.contains(r, c) {
+				continue
+			}
+			if sr, sc := r-rng.startRow, c-rng.startCol; sr < len(src) && sc < len(src[sr]) {
+				continue // overwritten, counted above
+			}
+			changed++
+		}
+	}
+	return changed
+}
+
+// upsertChanges returns the number of cells that would change when the merge
+// is applied to the existing values, raw are the same values unformatted, or
+// nil.  The cells of the deleted rows are counted as changed.
+func upsertChanges(existing, raw [][]interface{}, m *merge) (int, error) {
+	changed := 0
+	for _, vr := range m.updates {
+		rng, err := parseA1(vr.Range)
+		if err != nil {
+			return 0, err
+		}
+		for _, row := range vr.Values {
+			for c, v := range row {
+				formatted, rawRow := rowAt(existing, rng.startRow), rowAt(raw, rng.startRow)
+				if !cellEqual(v, cellAt(formatted, rng.startCol+c), cellAt(rawRow, rng.startCol+c)) {
+					changed++
+				}
+			}
+		}
+	}
+	for _, r := range m.deleted {
+		changed += countCells(existing[r : r+1])
+	}
+	return changed, nil
+}
+
+// contains returns true if the cell at the zero-based row and col is within
+// the range.
+func (rng a1Range) contains(row, col int) bool {
+	return row >= rng.startRow && (rng.endRow < 0 || row <= rng.endRow) &&
+		col >= rng.startCol && (rng.endCol < 0 || col <= rng.endCol)
+}
+
+// cellValue returns the value of the cell, or an empty string if the cell is
+// outside of values.
+func cellValue(values [][]interface{}, row, col int) string {
+	if row >= len(values) || col >= len(values[row]) {
+		return ""
+	}
+	return fmt.Sprint(values[row][col])
+}
+
+// countCells returns the number of non-empty cells.
+func countCells(values [][]interface{}) int {
+	n := 0
+	for _, row := range values {
+		for _, v := range row {
+			if fmt.Sprint(v) != "" {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
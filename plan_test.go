@@ -0,0 +1,189 @@
+package xls2sheets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/sheets/v4"
+)
+
+func Test_overwriteChanges(t *testing.T) {
+	existing := [][]interface{}{
+		{"Date", "Rate"},
+		{"2020-01-01", "1.5"},
+		{"2020-01-02", "1.6", "note"},
+	}
+	src := [][]interface{}{
+		{"2020-01-01", "1.5"},
+		{"2020-01-02", "1.7"},
+	}
+	tests := []struct {
+		name    string
+		address string
+		clear   bool
+		want    int
+	}{
+		{"same values", "Data!A2", false, 1},
+		{"clear", "Data", true, 7},
+		{"clear single cell", "Data!A2", true, 1},
+		{"offset", "Data!B1", false, 4},
+		{"new sheet", "New!A1", false, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng, err := parseA1(tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			current := existing
+			if rng.sheet == "New" {
+				current = nil
+			}
+			if got := overwriteChanges(current, src, rng, tt.clear); got != tt.want {
+				t.Errorf("overwriteChanges() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_upsertChanges(t *testing.T) {
+	existing := [][]interface{}{
+		{"id", "name"},
+		{"1", "one"},
+		{"2", "two"},
+		{"3", "three"},
+	}
+	src := [][]interface{}{
+		{"1", "one"},
+		{"2", "TWO"},
+		{"4", "four"},
+	}
+	m, err := mergeRows("Data", existing, nil, src, 1, 0, []int{0}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := upsertChanges(existing, nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one cell updated, two cells added, two cells deleted.
+	if got != 5 {
+		t.Errorf("upsertChanges() = %d, want 5", got)
+	}
+}
+
+func TestTaskPlan_String(t *testing.T) {
+	p := &TaskPlan{
+		Name:          "01_rates",
+		SpreadsheetID: "sheet-id",
+		CreateSheets:  []string{"Rates"},
+		Ranges: []*RangePlan{
+			{Source: "Data!A1:U", Target: "Rates", Clear: true, Cells: 42},
+			{Source: "Data", Target: "History!A1", Mode: ModeUpsert, Updated: 1, Added: 2, Cells: 7},
+			{Source: "Data", Target: "Formatted", CopySheet: true},
+			{Source: "Data", Target: "Charts", ReplaceSheet: true},
+		},
+		Export:       "rates.xlsx",
+		ExportExists: true,
+	}
+	want := "task \"01_rates\": spreadsheet sheet-id\n" +
+		"  + create sheet \"Rates\"\n" +
+		"  * \"Data!A1:U\" -> \"Rates\": clear, 42 cells changed\n" +
+		"  * \"Data\" -> \"History!A1\": 1 rows updated, 2 rows added, 0 rows deleted, 7 cells changed\n" +
+		"  * \"Data\" -> \"Formatted\": copy sheet\n" +
+		"  * \"Data\" -> \"Charts\": replace sheet\n" +
+		"  * export to rates.xlsx: overwrite, backup to rates.xlsx.bak\n"
+	if got := p.String(); got != want {
+		t.Errorf("TaskPlan.String() = %q, want %q", got, want)
+	}
+
+	failed := &TaskPlan{Name: "02_fail", Err: errors.New("boom")}
+	if got := failed.String(); got != "task \"02_fail\": error: boom\n" {
+		t.Errorf("TaskPlan.String() = %q", got)
+	}
+}
+
+// readOnlyAPI is the fake Google API, that serves the spreadsheets with one
+// "Data" sheet, and records all requests, other than reads.
+type readOnlyAPI struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+func (api *readOnlyAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if r.Method != http.MethodGet {
+		api.writes = append(api.writes, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	switch {
+	case strings.Contains(r.URL.Path, "/values/"):
+		json.NewEncoder(w).Encode(sheets.ValueRange{Values: [][]interface{}{{"a", "b"}}})
+	case strings.HasPrefix(r.URL.Path, "/v4/spreadsheets/"):
+		json.NewEncoder(w).Encode(map[string]interface{}{"sheets": []interface{}{
+			map[string]interface{}{"properties": map[string]interface{}{"sheetId": 0, "title": "Data"}},
+		}})
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestJob_PlanContext_readOnly(t *testing.T) {
+	jr, err := OpenJournal(filepath.Join(t.TempDir(), "job.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jr.add(tempFilePrefix+"1600000000.xlsx", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	job := &Job{
+		Tasks: Tasks{"gsheet": &Task{
+			Source: &Source{FileLocation: "1lqbZm_TCsqcOTvOHPjG2CvZ6PpmDtBg_6qe-J1I91sk", SheetAddressRange: []string{"Data"}},
+			Target: &Target{SpreadsheetID: "2lqbZm_TCsqcOTvOHPjG2CvZ6PpmDtBg_6qe-J1I91sk", SheetAddress: []string{"Data"}},
+		}},
+		Journal: jr,
+	}
+	api := &readOnlyAPI{}
+	if _, err := job.PlanContext(context.Background(), apiClient(t, api)); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.writes) > 0 {
+		t.Errorf("PlanContext() must not change anything, got: %v", api.writes)
+	}
+	if got := len(jr.Entries()); got != 1 {
+		t.Errorf("PlanContext() must not purge the journal, %d entries left", got)
+	}
+}
+
+func TestTarget_plan_copySheet(t *testing.T) {
+	ctx := context.Background()
+	client := apiClient(t, &readOnlyAPI{})
+	src, err := newSheetSvc(client, "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trg := &Target{SpreadsheetID: "trg", SheetAddress: []string{"Data"}, CopySheet: true}
+	p, err := trg.plan(ctx, client, src, []string{"Data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*RangePlan{{Source: "Data", Target: "Data", CopySheet: true}}
+	if diff := cmp.Diff(want, p.Ranges); diff != "" {
+		t.Errorf("Target.plan() (-want,+got):\n%s", diff)
+	}
+
+	// the plan must fail the same way as the update would.
+	local := &workbook{sheets: []*worksheet{{title: "Data"}}}
+	if _, err := trg.plan(ctx, client, local, []string{"Data"}); !errors.Is(err, errCopySheetLocal) {
+		t.Errorf("Target.plan() error = %v, want %v", err, errCopySheetLocal)
+	}
+}
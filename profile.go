@@ -0,0 +1,89 @@
+package xls2sheets
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// profileClients maps the auth profile name to its client, the empty name
+// is the default client.
+type profileClients map[string]*http.Client
+
+// source returns the client for the task source.
+func (pc profileClients) source(task *Task) *http.Client {
+	return pc[task.sourceProfile()]
+}
+
+// target returns the client for the task target.
+func (pc profileClients) target(task *Task) *http.Client {
+	return pc[task.targetProfile()]
+}
+
+// clients returns the clients of the job: client is the default one, and
+// Clients provide the clients of the profiles.  All clients are rate limited.
+// It returns an error if any of the tasks refers to the profile without the
+// client.
+func (j *Job) clients(client *http.Client) (profileClients, error) {
+	pc := profileClients{"": j.RateLimit.client(client)}
+	for _, name := range j.TaskNames() {
+		for _, profile := range j.Tasks[name].profiles() {
+			if _, ok := pc[profile]; ok {
+				continue
+			}
+			c, ok := j.Clients[profile]
+			if !ok || c == nil {
+				return nil, fmt.Errorf("task %q: unknown profile %q", name, profile)
+			}
+			pc[profile] = j.RateLimit.client(c)
+		}
+	}
+	return pc, nil
+}
+
+// Profiles returns the sorted names of the auth profiles that the tasks
+// refer to.
+func (j *Job) Profiles() []string {
+	seen := make(map[string]bool)
+	var profiles []string
+	for _, task := range j.Tasks {
+		for _, profile := range task.profiles() {
+			if !seen[profile] {
+				seen[profile] = true
+				profiles = append(profiles, profile)
+			}
+		}
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// profiles returns the non-empty profiles of the task source and target.
+func (task *Task) profiles() []string {
+	var profiles []string
+	if p := task.sourceProfile(); p != "" {
+		profiles = append(profiles, p)
+	}
+	if p := task.targetProfile(); p != "" {
+		profiles = append(profiles, p)
+	}
+	return profiles
+}
+
+// sourceProfile returns the profile for the task source: the source profile
+// takes precedence over the task profile.
+func (task *Task) sourceProfile() string {
+	if task.Source != nil && task.Source.Profile != "" {
+		return task.Source.Profile
+	}
+	return task.Profile
+}
+
+// targetProfile returns the profile for the task target: the target profile
+// takes precedence over the task profile.
+func (task *Task) targetProfile() string {
+	if task.Target != nil && task.Target.Profile != "" {
+		return task.Target.Profile
+	}
+	return task.Profile
+}
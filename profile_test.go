@@ -0,0 +1,69 @@
+package xls2sheets
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const profilesConfig = `
+sales:
+  profile: work
+  source:
+    location: 1lqbZm_TCsqcOTvOHPjG2CvZ6PpmDtBg_6qe-J1I91sk
+    address_range: [ Sheet1!A1:C ]
+    profile: home
+  target:
+    spreadsheet_id: 2lqbZm_TCsqcOTvOHPjG2CvZ6PpmDtBg_6qe-J1I91sk
+    address: [ Sheet1!A1 ]
+rates:
+  source:
+    location: https://www.example.com/rates.csv
+  target:
+    spreadsheet_id: 3lqbZm_TCsqcOTvOHPjG2CvZ6PpmDtBg_6qe-J1I91sk
+    address: [ Rates!A1 ]
+`
+
+func TestJob_Profiles(t *testing.T) {
+	job, err := NewJobFromConfig([]byte(profilesConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"home", "work"}, job.Profiles()); diff != "" {
+		t.Errorf("Job.Profiles() (-want,+got):\n%s", diff)
+	}
+	sales := job.Tasks["sales"]
+	if src, trg := sales.sourceProfile(), sales.targetProfile(); src != "home" || trg != "work" {
+		t.Errorf("sales: source profile = %q, target profile = %q, want home and work", src, trg)
+	}
+	if p := job.Tasks["rates"].profiles(); len(p) != 0 {
+		t.Errorf("rates: unexpected profiles %v", p)
+	}
+}
+
+func TestJob_clients(t *testing.T) {
+	job, err := NewJobFromConfig([]byte(profilesConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, home, work := &http.Client{}, &http.Client{}, &http.Client{}
+
+	job.Clients = map[string]*http.Client{"home": home}
+	if _, err := job.clients(def); err == nil {
+		t.Error("Job.clients() expected an error for the unknown profile")
+	}
+
+	job.Clients["work"] = work
+	pc, err := job.clients(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sales, rates := job.Tasks["sales"], job.Tasks["rates"]
+	if pc.source(sales) != home || pc.target(sales) != work {
+		t.Error("sales: expected the home client for the source and the work client for the target")
+	}
+	if pc.source(rates) != def || pc.target(rates) != def {
+		t.Error("rates: expected the default client")
+	}
+}
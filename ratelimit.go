@@ -0,0 +1,150 @@
+package xls2sheets
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimit limits the number of Google API requests per minute, so that the
+// job stays within the per-user quotas, i.e. when tasks are run in parallel.
+// Read and write requests are counted separately, for each API.  Zero
+// values mean no limit.
+type RateLimit struct {
+	// ReadsPerMinute is the maximum number of read requests per minute.
+	ReadsPerMinute int
+	// WritesPerMinute is the maximum number of write requests per minute.
+	WritesPerMinute int
+}
+
+// client returns the client that waits before sending the request if the
+// rate limit is reached.  If there are no limits, client is returned as is.
+func (rl RateLimit) client(client *http.Client) *http.Client {
+	if rl.ReadsPerMinute <= 0 && rl.WritesPerMinute <= 0 {
+		return client
+	}
+	limited := *client
+	limited.Transport = &limiter{
+		next:    client.Transport,
+		limit:   rl,
+		buckets: make(map[bucketKey]*bucket),
+	}
+	return &limited
+}
+
+// limiter is the http.RoundTripper that limits the rate of requests.
+type limiter struct {
+	next  http.RoundTripper
+	limit RateLimit
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+}
+
+// bucketKey identifies the quota bucket: the API host and the type of the
+// request.
+type bucketKey struct {
+	host  string
+	write bool
+}
+
+func (l *limiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	write := req.Method != http.MethodGet && req.Method != http.MethodHead
+	if b := l.bucket(bucketKey{host: req.URL.Host, write: write}); b != nil {
+		if err := b.wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	next := l.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req)
+}
+
+// bucket returns the bucket for the key, or nil if there is no limit.
+func (l *limiter) bucket(key bucketKey) *bucket {
+	perMinute := l.limit.ReadsPerMinute
+	if key.write {
+		perMinute = l.limit.WritesPerMinute
+	}
+	if perMinute <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newBucket(perMinute, time.Now())
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// bucket is the token bucket.  Tokens are added at the constant rate, up to
+// the burst size, and every request takes one token.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket creates the bucket for perMinute requests per minute.  The burst
+// is a tenth of the limit, so that the requests are spread across the
+// minute, and the quota is not exceeded in any minute window.
+func newBucket(perMinute int, now time.Time) *bucket {
+	burst := float64(perMinute) / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{
+		rate:   float64(perMinute) / 60,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+// reserve takes the token from the bucket and returns the time to wait
+// until it becomes available.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns the reserved token to the bucket.
+func (b *bucket) cancel() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
+
+// wait takes the token from the bucket, waiting until it becomes available.
+func (b *bucket) wait(ctx context.Context) error {
+	d := b.reserve(time.Now())
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package xls2sheets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_bucket_reserve(t *testing.T) {
+	start := time.Now()
+	b := newBucket(60, start) // 1 request per second, burst 6
+
+	for i := 0; i < 6; i++ {
+		if d := b.reserve(start); d != 0 {
+			t.Fatalf("bucket.reserve() request %d: unexpected wait %s", i, d)
+		}
+	}
+	if d := b.reserve(start); d != time.Second {
+		t.Errorf("bucket.reserve() = %s, want 1s", d)
+	}
+	if d := b.reserve(start); d != 2*time.Second {
+		t.Errorf("bucket.reserve() = %s, want 2s", d)
+	}
+	// after a minute the bucket is full again, but not above the burst.
+	later := start.Add(time.Minute)
+	for i := 0; i < 6; i++ {
+		if d := b.reserve(later); d != 0 {
+			t.Fatalf("bucket.reserve() request %d: unexpected wait %s", i, d)
+		}
+	}
+	if d := b.reserve(later); d == 0 {
+		t.Error("bucket.reserve() expected to wait after the burst")
+	}
+}
+
+func Test_bucket_wait_cancelled(t *testing.T) {
+	b := newBucket(1, time.Now())
+	if err := b.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.wait(ctx); err != context.Canceled {
+		t.Errorf("bucket.wait() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRateLimit_client(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	if c := (RateLimit{}).client(srv.Client()); c != srv.Client() {
+		t.Error("RateLimit.client() expected the same client without limits")
+	}
+
+	client := RateLimit{ReadsPerMinute: 600}.client(srv.Client())
+	l := client.Transport.(*limiter)
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := client.Post(srv.URL, "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	if b := l.buckets[bucketKey{host: host}]; b == nil || b.tokens > b.burst-2.5 {
+		t.Errorf("limiter: expected 3 tokens to be taken from the read bucket")
+	}
+	if _, ok := l.buckets[bucketKey{host: host, write: true}]; ok {
+		t.Error("limiter: unexpected write bucket, writes are not limited")
+	}
+}
@@ -0,0 +1,222 @@
+package xls2sheets
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Retry defaults.
+const (
+	defMaxAttempts = 5
+	defMinDelay    = time.Second
+	defMaxDelay    = time.Minute // Sheets API quotas are per minute.
+)
+
+// RetryPolicy defines how the failed Google API and web requests are
+// retried.  Requests are retried on rate limit errors, server errors and
+// network errors, with the jittered exponential backoff.  Zero values mean
+// defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one.  Default is 5, 1 disables retries.
+	MaxAttempts int
+	// MinDelay is the delay before the first retry, it doubles with every
+	// attempt.  Default is 1 second.
+	MinDelay time.Duration
+	// MaxDelay is the maximum delay between the attempts, unless the
+	// server asks to wait longer.  Default is 1 minute.
+	MaxDelay time.Duration
+}
+
+type retryPolicyKey struct{}
+
+// withRetryPolicy returns the context that carries the retry policy.
+func withRetryPolicy(ctx context.Context, p RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, p)
+}
+
+// retryPolicy returns the retry policy from the context, with the defaults
+// applied.
+func retryPolicy(ctx context.Context) RetryPolicy {
+	p, _ := ctx.Value(retryPolicyKey{}).(RetryPolicy)
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defMaxAttempts
+	}
+	if p.MinDelay <= 0 {
+		p.MinDelay = defMinDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defMaxDelay
+	}
+	return p
+}
+
+// jitter is the random source for the backoff jitter.
+var jitter = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// delay returns the delay before the attempt (starting from 1, which is the
+// first retry).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.MinDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// a random delay in [d/2, d)
+	jitter.Lock()
+	defer jitter.Unlock()
+	return d/2 + time.Duration(jitter.Int63n(int64(d/2)+1))
+}
+
+// retry calls fn until it succeeds, returns a permanent error, the attempts
+// are exhausted, or the context is cancelled.  The retry policy is taken
+// from the context.
+func retry(ctx context.Context, fn func() error) error {
+	p := retryPolicy(ctx)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || attempt >= p.MaxAttempts {
+			return err
+		}
+		ok, retryAfter := retryable(err)
+		if !ok {
+			return err
+		}
+		d := p.delay(attempt)
+		if retryAfter > d {
+			d = retryAfter
+		}
+		log.Printf("! request failed (attempt %d of %d), retrying in %s: %s", attempt, p.MaxAttempts, d.Round(time.Millisecond), err)
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// retryChecked is the same as retry, but it is used for the requests that
+// can't be repeated blindly.  If the request has failed, but might have been
+// processed by the server, check is called before the next attempt.  The
+// requests that were rejected because of the rate limits were not processed,
+// and are repeated without the check.  check
+// returns true if the request has taken effect, then it is not repeated.
+// Otherwise check must undo the partial effects of the request, if any.
+func retryChecked(ctx context.Context, fn func() error, check func() (bool, error)) error {
+	var uncertain bool
+	return retry(ctx, func() error {
+		if uncertain {
+			done, err := check()
+			if err != nil || done {
+				return err
+			}
+		}
+		err := fn()
+		ok, _ := rejected(err)
+		uncertain = err != nil && !ok
+		return err
+	})
+}
+
+// rateLimitReasons are the reasons of the 403 errors, that are returned
+// when the quota is exceeded.
+var rateLimitReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+}
+
+// retryable returns true if the request that failed with err can be
+// retried, and the delay that the server asked for, if any.
+func retryable(err error) (bool, time.Duration) {
+	if ok, d := rejected(err); ok {
+		return true, d
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.Code), retryAfter(apiErr.Header)
+	}
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return retryableStatus(statusErr.code), retryAfter(statusErr.header)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true, 0
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true, 0
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr), 0
+}
+
+// rejected returns true if the request that failed with err was rejected
+// because of the rate limits, and the delay that the server asked for, if
+// any.
+func rejected(err error) (bool, time.Duration) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false, 0
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true, retryAfter(apiErr.Header)
+	}
+	if apiErr.Code == http.StatusForbidden {
+		for _, item := range apiErr.Errors {
+			if rateLimitReasons[item.Reason] {
+				return true, retryAfter(apiErr.Header)
+			}
+		}
+	}
+	return false, 0
+}
+
+// retryableStatus returns true if the request that failed with the HTTP
+// status code can be retried.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay from the Retry-After header, which is either
+// the number of seconds, or the HTTP date.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
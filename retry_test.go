@@ -0,0 +1,162 @@
+package xls2sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func Test_retryable(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		want         bool
+		wantDelay    time.Duration
+		wantRejected bool
+	}{
+		{"too many requests", &googleapi.Error{Code: 429, Header: http.Header{"Retry-After": {"7"}}}, true, 7 * time.Second, true},
+		{"rate limit", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, true, 0, true},
+		{"forbidden", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, false, 0, false},
+		{"server error", &googleapi.Error{Code: 503}, true, 0, false},
+		{"not found", &googleapi.Error{Code: 404}, false, 0, false},
+		{"wrapped", fmt.Errorf("task: %w", &googleapi.Error{Code: 500}), true, 0, false},
+		{"web", &statusError{code: 502}, true, 0, false},
+		{"web not found", &statusError{code: 404}, false, 0, false},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true, 0, false},
+		{"unexpected eof", io.ErrUnexpectedEOF, true, 0, false},
+		{"other", errors.New("boom"), false, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotDelay := retryable(tt.err)
+			if got != tt.want || gotDelay != tt.wantDelay {
+				t.Errorf("retryable() = %v, %s, want %v, %s", got, gotDelay, tt.want, tt.wantDelay)
+			}
+			if got, _ := rejected(tt.err); got != tt.wantRejected {
+				t.Errorf("rejected() = %v, want %v", got, tt.wantRejected)
+			}
+		})
+	}
+}
+
+func Test_retry(t *testing.T) {
+	ctx := withRetryPolicy(context.Background(), RetryPolicy{MaxAttempts: 3, MinDelay: time.Millisecond})
+	errServer := &googleapi.Error{Code: 500}
+
+	var calls int
+	err := retry(ctx, func() error {
+		calls++
+		if calls < 3 {
+			return errServer
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("retry() = %v after %d calls, want success after 3 calls", err, calls)
+	}
+
+	calls = 0
+	err = retry(ctx, func() error {
+		calls++
+		return errServer
+	})
+	if err != errServer || calls != 3 {
+		t.Errorf("retry() = %v after %d calls, want %v after 3 calls", err, calls, errServer)
+	}
+
+}
+
+func Test_retryChecked(t *testing.T) {
+	ctx := withRetryPolicy(context.Background(), RetryPolicy{MaxAttempts: 3, MinDelay: time.Millisecond})
+	errServer := &googleapi.Error{Code: 503}
+	errRejected := &googleapi.Error{Code: 429}
+	tests := []struct {
+		name       string
+		err        error // error of the first call
+		done       bool  // check result
+		wantCalls  int
+		wantChecks int
+	}{
+		{"processed", errServer, true, 1, 1},
+		{"not processed", errServer, false, 2, 1},
+		{"rejected", errRejected, true, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, checks int
+			err := retryChecked(ctx, func() error {
+				calls++
+				if calls == 1 {
+					return tt.err
+				}
+				return nil
+			}, func() (bool, error) {
+				checks++
+				return tt.done, nil
+			})
+			if err != nil || calls != tt.wantCalls || checks != tt.wantChecks {
+				t.Errorf("retryChecked() = %v after %d calls and %d checks, want success after %d calls and %d checks", err, calls, checks, tt.wantCalls, tt.wantChecks)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_delay(t *testing.T) {
+	p := RetryPolicy{MinDelay: time.Second, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{10, 2500 * time.Millisecond, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.delay(tt.attempt); got < tt.min || got > tt.max {
+			t.Errorf("RetryPolicy.delay(%d) = %s, want between %s and %s", tt.attempt, got, tt.min, tt.max)
+		}
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	if got := retryAfter(http.Header{"Retry-After": {"120"}}); got != 2*time.Minute {
+		t.Errorf("retryAfter() = %s, want 2m", got)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := retryAfter(http.Header{"Retry-After": {date}}); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("retryAfter() = %s, want about 1h", got)
+	}
+	if got := retryAfter(nil); got != 0 {
+		t.Errorf("retryAfter() = %s, want 0", got)
+	}
+}
+
+func TestHTTPOptions_fetch_retry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("a,b\n"))
+	}))
+	defer srv.Close()
+
+	ctx := withRetryPolicy(context.Background(), RetryPolicy{MinDelay: time.Millisecond})
+	_, data, err := (*HTTPOptions)(nil).fetch(ctx, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a,b\n" || calls != 2 {
+		t.Errorf("HTTPOptions.fetch() = %q after %d calls", data, calls)
+	}
+}
@@ -0,0 +1,242 @@
+package xls2sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+var (
+	errDependencyFailed = errors.New("dependency has failed")
+	errAborted          = errors.New("not started, job was aborted")
+)
+
+// Error policies.
+const (
+	OnErrorContinue = "continue" // continue running other tasks (default)
+	OnErrorAbort    = "abort"    // do not start any new tasks
+)
+
+// JobError is returned by Execute if some tasks of the job did not succeed.
+type JobError struct {
+	// Total is the number of tasks in the job.
+	Total int
+	// Errors maps the name of each unsuccessful task to its error.  Tasks
+	// that were skipped or not started have errors too.
+	Errors map[string]error
+	// Aborted is true if the job was aborted due to a task error.
+	Aborted bool
+}
+
+func (e *JobError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d of %d tasks did not succeed", len(e.Errors), e.Total)
+	if e.Aborted {
+		sb.WriteString(" (job aborted)")
+	}
+	for _, name := range names {
+		fmt.Fprintf(&sb, "\n\t%s: %s", name, e.Errors[name])
+	}
+	return sb.String()
+}
+
+// Succeeded returns the number of tasks that have succeeded.
+func (e *JobError) Succeeded() int {
+	return e.Total - len(e.Errors)
+}
+
+// onError returns the error policy of the task.  Task policy takes
+// precedence over the job policy.
+func (j *Job) onError(taskName string) string {
+	if policy := j.Tasks[taskName].OnError; policy != "" {
+		return policy
+	}
+	if j.OnError != "" {
+		return j.OnError
+	}
+	return OnErrorContinue
+}
+
+// validOnError returns an error if the error policy is unknown.
+func validOnError(policy string) error {
+	switch policy {
+	case "", OnErrorContinue, OnErrorAbort:
+		return nil
+	}
+	return fmt.Errorf("unknown error policy: %q", policy)
+}
+
+// validate checks that all task dependencies exist and that there are no
+// cycles between them.
+func (j *Job) validate() error {
+	if err := validOnError(j.OnError); err != nil {
+		return err
+	}
+	for _, name := range j.TaskNames() {
+		task := j.Tasks[name]
+		if task == nil {
+			return fmt.Errorf("task %q: empty task definition", name)
+		}
+		if err := validOnError(task.OnError); err != nil {
+			return fmt.Errorf("task %q: %w", name, err)
+		}
+		seen := make(map[string]bool, len(task.DependsOn))
+		for _, dep := range task.DependsOn {
+			if _, ok := j.Tasks[dep]; !ok {
+				return fmt.Errorf("task %q: unknown dependency %q", name, dep)
+			}
+			if seen[dep] {
+				return fmt.Errorf("task %q: duplicate dependency %q", name, dep)
+			}
+			seen[dep] = true
+		}
+	}
+	if cycle := j.findCycle(); cycle != nil {
+		return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// findCycle returns the first dependency cycle found, i.e. [a, b, a], or nil
+// if the dependencies are acyclic.
+func (j *Job) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(j.Tasks))
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// the cycle starts where the name first appears on the path.
+			for i := range path {
+				if path[i] == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+		state[name] = visiting
+		path = append(path, name)
+		deps := append([]string{}, j.Tasks[name].DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range j.TaskNames() {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// schedule runs every task with fn, once all the tasks it depends on have
+// succeeded.  Up to parallel tasks are run at the same time, tasks that are
+// ready to run are started in alphabetical order.  Tasks that depend on a
+// failed or skipped task are skipped.  If the failed task has the abort error
+// policy, or the context is cancelled, no new tasks are started.  It returns
+// the result of each task, the result of a skipped task wraps
+// errDependencyFailed, and the result of a task that was not started due to
+// abort is errAborted.  Job must be validated.
+func (j *Job) schedule(ctx context.Context, parallel int, fn func(taskName string) error) map[string]error {
+	if parallel < 1 {
+		parallel = 1
+	}
+	type result struct {
+		name string
+		err  error
+	}
+
+	waiting := make(map[string]int, len(j.Tasks)) // number of unfinished dependencies
+	dependents := make(map[string][]string, len(j.Tasks))
+	var ready []string
+	for _, name := range j.TaskNames() {
+		deps := j.Tasks[name].DependsOn
+		waiting[name] = len(deps)
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], name)
+		}
+		if len(deps) == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	results := make(map[string]error, len(j.Tasks))
+	// skip marks all tasks downstream of the failed task as skipped.
+	var skip func(failed string)
+	skip = func(failed string) {
+		for _, name := range dependents[failed] {
+			if _, done := results[name]; done {
+				continue
+			}
+			log.Printf("task %q: skipped, dependency %q has failed", name, failed)
+			results[name] = fmt.Errorf("%w: %q", errDependencyFailed, failed)
+			skip(name)
+		}
+	}
+
+	resultC := make(chan result)
+	running := 0
+	aborted := false
+	for {
+		if ctx.Err() != nil && !aborted {
+			log.Printf("job cancelled: %s", ctx.Err())
+			aborted = true
+		}
+		for running < parallel && len(ready) > 0 && !aborted {
+			name := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				resultC <- result{name: name, err: fn(name)}
+			}()
+		}
+		if running == 0 {
+			break // nothing is running, and nothing can be started.
+		}
+		res := <-resultC
+		running--
+		results[res.name] = res.err
+		if res.err != nil {
+			skip(res.name)
+			if j.onError(res.name) == OnErrorAbort && !aborted {
+				log.Printf("task %q: failed, aborting the job", res.name)
+				aborted = true
+			}
+			continue
+		}
+		for _, name := range dependents[res.name] {
+			waiting[name]--
+			if _, skipped := results[name]; waiting[name] == 0 && !skipped {
+				ready = append(ready, name)
+			}
+		}
+		sort.Strings(ready)
+	}
+	for name := range j.Tasks {
+		if _, done := results[name]; !done {
+			results[name] = errAborted
+		}
+	}
+	return results
+}
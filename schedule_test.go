@@ -0,0 +1,176 @@
+package xls2sheets
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testJob creates a job with tasks, that have dependencies as specified in
+// deps.
+func testJob(deps map[string][]string) *Job {
+	j := &Job{Tasks: make(Tasks, len(deps))}
+	for name, dd := range deps {
+		j.Tasks[name] = &Task{DependsOn: dd}
+	}
+	return j
+}
+
+func TestJob_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		deps    map[string][]string
+		wantErr string
+	}{
+		{"no deps", map[string][]string{"a": nil, "b": nil}, ""},
+		{"chain", map[string][]string{"a": nil, "b": {"a"}, "c": {"a", "b"}}, ""},
+		{"unknown", map[string][]string{"a": {"x"}}, `task "a": unknown dependency "x"`},
+		{"duplicate", map[string][]string{"a": nil, "b": {"a", "a"}}, `task "b": duplicate dependency "a"`},
+		{"self", map[string][]string{"a": {"a"}}, "dependency cycle: a -> a"},
+		{"cycle", map[string][]string{"a": {"c"}, "b": {"a"}, "c": {"b"}, "d": nil}, "dependency cycle: a -> c -> b -> a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testJob(tt.deps).validate()
+			var got string
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.wantErr {
+				t.Errorf("Job.validate() error = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJob_schedule(t *testing.T) {
+	errFail := errors.New("fail")
+	j := testJob(map[string][]string{
+		"01_fetch":  nil,
+		"02_fail":   nil,
+		"03_report": {"01_fetch"},
+		"04_after":  {"02_fail"},
+		"05_chain":  {"04_after"},
+		"06_both":   {"01_fetch", "03_report"},
+	})
+
+	var order []string
+	results := j.schedule(context.Background(), 1, func(taskName string) error {
+		order = append(order, taskName)
+		if taskName == "02_fail" {
+			return errFail
+		}
+		return nil
+	})
+	if diff := cmp.Diff([]string{"01_fetch", "02_fail", "03_report", "06_both"}, order); diff != "" {
+		t.Errorf("Job.schedule() order mismatch (-want,+got):\n%s", diff)
+	}
+	for _, name := range []string{"01_fetch", "03_report", "06_both"} {
+		if results[name] != nil {
+			t.Errorf("Job.schedule() task %q: unexpected error: %s", name, results[name])
+		}
+	}
+	if !errors.Is(results["02_fail"], errFail) {
+		t.Errorf("Job.schedule() task 02_fail: unexpected error: %v", results["02_fail"])
+	}
+	for _, name := range []string{"04_after", "05_chain"} {
+		if !errors.Is(results[name], errDependencyFailed) {
+			t.Errorf("Job.schedule() task %q: expected to be skipped, got: %v", name, results[name])
+		}
+	}
+}
+
+func TestJob_schedule_parallel(t *testing.T) {
+	const parallel = 3
+	j := testJob(map[string][]string{"a": nil, "b": nil, "c": nil, "d": nil, "e": nil, "f": {"a"}})
+
+	var (
+		mu      sync.Mutex
+		running int
+		maxSeen int
+	)
+	release := make(chan struct{})
+	started := make(chan struct{}, len(j.Tasks))
+	go func() {
+		// wait until the pool is full, then let the tasks finish.
+		for i := 0; i < parallel; i++ {
+			<-started
+		}
+		close(release)
+	}()
+	results := j.schedule(context.Background(), parallel, func(taskName string) error {
+		mu.Lock()
+		running++
+		if running > maxSeen {
+			maxSeen = running
+		}
+		mu.Unlock()
+		started <- struct{}{}
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	if maxSeen != parallel {
+		t.Errorf("Job.schedule() ran %d tasks at the same time, want %d", maxSeen, parallel)
+	}
+	if len(results) != len(j.Tasks) {
+		t.Errorf("Job.schedule() returned %d results, want %d", len(results), len(j.Tasks))
+	}
+}
+
+func TestJob_schedule_abort(t *testing.T) {
+	errFail := errors.New("fail")
+	j := testJob(map[string][]string{"a": nil, "b": nil, "c": nil})
+	j.Tasks["b"].OnError = OnErrorAbort
+
+	var order []string
+	results := j.schedule(context.Background(), 1, func(taskName string) error {
+		order = append(order, taskName)
+		if taskName == "b" {
+			return errFail
+		}
+		return nil
+	})
+	if diff := cmp.Diff([]string{"a", "b"}, order); diff != "" {
+		t.Errorf("Job.schedule() order mismatch (-want,+got):\n%s", diff)
+	}
+	if results["c"] != errAborted {
+		t.Errorf("Job.schedule() task c: expected to be aborted, got: %v", results["c"])
+	}
+}
+
+func TestJobError(t *testing.T) {
+	err := &JobError{
+		Total:   3,
+		Errors:  map[string]error{"b": errors.New("boom"), "a": errAborted},
+		Aborted: true,
+	}
+	want := "2 of 3 tasks did not succeed (job aborted)\n\ta: not started, job was aborted\n\tb: boom"
+	if got := err.Error(); got != want {
+		t.Errorf("JobError.Error() = %q, want %q", got, want)
+	}
+	if got := err.Succeeded(); got != 1 {
+		t.Errorf("JobError.Succeeded() = %d, want 1", got)
+	}
+}
+
+func TestJob_schedule_cancelled(t *testing.T) {
+	j := testJob(map[string][]string{"a": nil, "b": nil})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := j.schedule(ctx, 1, func(taskName string) error {
+		t.Errorf("Job.schedule() task %q should not have been started", taskName)
+		return nil
+	})
+	for name, err := range results {
+		if err != errAborted {
+			t.Errorf("Job.schedule() task %q: expected to be aborted, got: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package xls2sheets
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces the secret values in the log output.
+const redacted = "xxxxx"
+
+var errEmptySecret = errors.New("secret value is empty")
+
+// Secret is the value that is set in the configuration file, or read from
+// the environment variable or the file.  In the configuration file, it is
+// either a string, or a mapping with one of the "value", "env" or "file"
+// keys:
+//
+//	bearer_token:
+//	  env: RATES_TOKEN
+type Secret struct {
+	Value string `yaml:"value,omitempty"`
+	// Env is the name of the environment variable with the value.
+	Env string `yaml:"env,omitempty"`
+	// File is the name of the file with the value, the trailing newline
+	// is removed.
+	File string `yaml:"file,omitempty"`
+}
+
+// UnmarshalYAML allows to set the secret value as a string.
+func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		*s = Secret{Value: value}
+		return nil
+	}
+	type secret Secret // prevent the recursion
+	return unmarshal((*secret)(s))
+}
+
+// String returns the redacted value, so that the secret does not get into
+// the logs by accident.
+func (s *Secret) String() string {
+	return redacted
+}
+
+// value returns the value of the secret.
+func (s *Secret) value() (string, error) {
+	if s == nil {
+		return "", errEmptySecret
+	}
+	var value string
+	switch {
+	case s.Env != "":
+		var ok bool
+		if value, ok = os.LookupEnv(s.Env); !ok {
+			return "", fmt.Errorf("environment variable %s is not set", s.Env)
+		}
+	case s.File != "":
+		data, err := os.ReadFile(os.ExpandEnv(s.File))
+		if err != nil {
+			return "", err
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	default:
+		value = s.Value
+	}
+	if value == "" {
+		return "", errEmptySecret
+	}
+	return value, nil
+}
+
+// BasicAuth is the username and password for the HTTP basic
+// authentication.
+type BasicAuth struct {
+	Username *Secret `yaml:"username"`
+	Password *Secret `yaml:"password"`
+}
+
+// secretParamRe matches the names of URL query parameters that may contain
+// secrets.
+var secretParamRe = regexp.MustCompile(`(?i)token|key|secret|pass|auth|sig|session|credential`)
+
+// redactURL returns the location with the password and the values of the
+// query parameters that look like secrets replaced, so that it can be
+// logged.  Locations that are not URLs are returned as is.
+func redactURL(loc string) string {
+	if !strings.Contains(loc, "://") {
+		return loc
+	}
+	u, err := url.Parse(loc)
+	if err != nil {
+		return redacted
+	}
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			if secretParamRe.MatchString(k) {
+				q[k] = []string{redacted}
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
@@ -2,19 +2,25 @@ package xls2sheets
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
 
 	"google.golang.org/api/sheets/v4"
 )
 
+var (
+	errAppendUnknown = errors.New("append has failed, and it's unknown if the rows were appended")
+	errCopyUnknown   = errors.New("copy has failed, and it's unknown which sheet is the copy")
+)
+
 // sheetSvc is a type that has a number of wrappers around subset of sheets
 // Service functions.
 type sheetSvc struct {
 	svc           *sheets.Service
 	spreadsheetID string
+	opts          valueOptions
 }
 
 func newSheetSvc(client *http.Client, spreadsheetID string) (*sheetSvc, error) {
@@ -25,53 +31,429 @@ func newSheetSvc(client *http.Client, spreadsheetID string) (*sheetSvc, error) {
 	return &sheetSvc{svc: svc, spreadsheetID: spreadsheetID}, nil
 }
 
-// get returns a range of values from spreadsheet.
-func (s *sheetSvc) get(Range string) (*sheets.ValueRange, error) {
-	return s.svc.Spreadsheets.Values.Get(s.spreadsheetID, Range).Do()
+// get returns a range of values from spreadsheet, rendered according to the
+// value options.
+func (s *sheetSvc) get(ctx context.Context, Range string) (*sheets.ValueRange, error) {
+	var vr *sheets.ValueRange
+	err := retry(ctx, func() (err error) {
+		call := s.svc.Spreadsheets.Values.Get(s.spreadsheetID, Range)
+		if s.opts.render != "" {
+			call = call.ValueRenderOption(s.opts.render)
+		}
+		if s.opts.dateTime != "" {
+			call = call.DateTimeRenderOption(s.opts.dateTime)
+		}
+		vr, err = call.Context(ctx).Do()
+		return err
+	})
+	return vr, err
+}
+
+// titles returns the titles of all sheets of the spreadsheet.
+func (s *sheetSvc) titles(ctx context.Context) ([]string, error) {
+	var spreadsheet *sheets.Spreadsheet
+	err := retry(ctx, func() (err error) {
+		spreadsheet, err = s.svc.Spreadsheets.Get(s.spreadsheetID).Fields("sheets.properties.title").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	titles := make([]string, len(spreadsheet.Sheets))
+	for i, sh := range spreadsheet.Sheets {
+		titles[i] = sh.Properties.Title
+	}
+	return titles, nil
 }
 
 // clear clears range within the target spreadsheet.
-func (s *sheetSvc) clear(Range string) (*sheets.ClearValuesResponse, error) {
+func (s *sheetSvc) clear(ctx context.Context, Range string) (*sheets.ClearValuesResponse, error) {
 	// https://developers.google.com/sheets/api/reference/rest/v4/spreadsheets.values/clear
 	rb := &sheets.ClearValuesRequest{}
-	return s.svc.Spreadsheets.Values.Clear(s.spreadsheetID, Range, rb).Do()
+	var resp *sheets.ClearValuesResponse
+	err := retry(ctx, func() (err error) {
+		resp, err = s.svc.Spreadsheets.Values.Clear(s.spreadsheetID, Range, rb).Context(ctx).Do()
+		return err
+	})
+	return resp, err
 }
 
 // addSheet adds a sheet.
-func (s *sheetSvc) addSheet(address string) error {
-	titleRange := strings.SplitN(address, "!", 2)
-	if titleRange[0] == "" {
+func (s *sheetSvc) addSheet(ctx context.Context, address string) error {
+	title := sheetName(address)
+	if title == "" {
 		return fmt.Errorf("invalid address: %q", address)
 	}
 
 	requests := []*sheets.Request{
 		{AddSheet: &sheets.AddSheetRequest{
-			Properties: &sheets.SheetProperties{Title: titleRange[0]},
+			Properties: &sheets.SheetProperties{Title: title},
 		}},
 	}
 
 	rb := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
 
-	_, err := s.svc.Spreadsheets.BatchUpdate(s.spreadsheetID, rb).Do()
+	// adding the sheet twice fails, so the request is not repeated if the
+	// failed one has added the sheet.
+	err := retryChecked(ctx, func() error {
+		_, err := s.svc.Spreadsheets.BatchUpdate(s.spreadsheetID, rb).Context(ctx).Do()
+		return err
+	}, func() (bool, error) {
+		props, err := s.findSheet(ctx, title)
+		return props != nil, err
+	})
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *sheetSvc) update(data *sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error) {
-	const valueInputOption = userEntered // proper formatting of resulting values
-
+// update writes the data ranges to the spreadsheet.
+func (s *sheetSvc) update(ctx context.Context, data ...*sheets.ValueRange) (*sheets.BatchUpdateValuesResponse, error) {
 	// Reference: https://developers.google.com/sheets/api/reference/rest/v4/spreadsheets.values/batchUpdate
 	rb := &sheets.BatchUpdateValuesRequest{
-		ValueInputOption: valueInputOption,
-		Data:             []*sheets.ValueRange{data},
+		ValueInputOption: s.opts.inputOption(),
+		Data:             data,
+	}
+
+	var resp *sheets.BatchUpdateValuesResponse
+	err := retry(ctx, func() (err error) {
+		resp, err = s.svc.Spreadsheets.Values.
+			BatchUpdate(s.spreadsheetID, rb).
+			Context(ctx).
+			Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// sheetID returns the ID of the sheet with the title.
+func (s *sheetSvc) sheetID(ctx context.Context, title string) (int64, error) {
+	props, err := s.findSheet(ctx, title)
+	if err != nil {
+		return 0, err
+	}
+	if props == nil {
+		return 0, fmt.Errorf("sheet not found: %q", title)
+	}
+	return props.SheetId, nil
+}
+
+// findSheet returns the properties of the sheet with the title, or nil, if
+// there's no such sheet.
+func (s *sheetSvc) findSheet(ctx context.Context, title string) (*sheets.SheetProperties, error) {
+	props, err := s.properties(ctx, s.spreadsheetID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range props {
+		if p.Title == title {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// hasSheetID returns true if the spreadsheet has the sheet with the ID.
+func (s *sheetSvc) hasSheetID(ctx context.Context, sheetID int64) (bool, error) {
+	props, err := s.properties(ctx, s.spreadsheetID)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range props {
+		if p.SheetId == sheetID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// properties returns the properties of all sheets of the spreadsheet with
+// the ID.
+func (s *sheetSvc) properties(ctx context.Context, spreadsheetID string) ([]*sheets.SheetProperties, error) {
+	var spreadsheet *sheets.Spreadsheet
+	err := retry(ctx, func() (err error) {
+		spreadsheet, err = s.svc.Spreadsheets.Get(spreadsheetID).Fields("sheets.properties(sheetId,title,index)").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	props := make([]*sheets.SheetProperties, len(spreadsheet.Sheets))
+	for i, sh := range spreadsheet.Sheets {
+		props[i] = sh.Properties
+	}
+	return props, nil
+}
+
+// copyTo copies the sheet with formatting to the spreadsheet with dstID,
+// and returns the properties of the copy.
+func (s *sheetSvc) copyTo(ctx context.Context, sheetID int64, dstID string) (*sheets.SheetProperties, error) {
+	// Reference: https://developers.google.com/sheets/api/reference/rest/v4/spreadsheets.sheets/copyTo
+	rb := &sheets.CopySheetToAnotherSpreadsheetRequest{DestinationSpreadsheetId: dstID}
+	// repeated copy would leave the extra sheets, so if the failed request
+	// has made the copy, the new sheet of the destination is used instead.
+	before, err := s.properties(ctx, dstID)
+	if err != nil {
+		return nil, err
+	}
+	var props *sheets.SheetProperties
+	err = retryChecked(ctx, func() (err error) {
+		props, err = s.svc.Spreadsheets.Sheets.CopyTo(s.spreadsheetID, sheetID, rb).Context(ctx).Do()
+		return err
+	}, func() (bool, error) {
+		after, err := s.properties(ctx, dstID)
+		if err != nil {
+			return false, err
+		}
+		added := newSheets(before, after)
+		switch len(added) {
+		case 0:
+			return false, nil
+		case 1:
+			props = added[0]
+			return true, nil
+		}
+		return false, fmt.Errorf("%w: %d sheets were added to the destination spreadsheet", errCopyUnknown, len(added))
+	})
+	return props, err
+}
+
+// newSheets returns the sheets of after, that are not in before.
+func newSheets(before, after []*sheets.SheetProperties) []*sheets.SheetProperties {
+	seen := make(map[int64]bool, len(before))
+	for _, p := range before {
+		seen[p.SheetId] = true
+	}
+	var added []*sheets.SheetProperties
+	for _, p := range after {
+		if !seen[p.SheetId] {
+			added = append(added, p)
+		}
 	}
+	return added
+}
+
+// pasteSheet pastes the contents of the sheet copyID into the sheet old,
+// and deletes the copy.  The values, formulas, formats, merges, data
+// validation and conditional formatting of the old sheet are replaced,
+// while the sheet itself is kept, so the references to it in other sheets'
+// formulas stay intact.  The grid of the old sheet is never shrunk, not to
+// break the references to its cells, and the charts are not copied.  The
+// changes are made in one batch, which either succeeds or fails as a whole.
+func (s *sheetSvc) pasteSheet(ctx context.Context, old *sheets.SheetProperties, copyID int64) error {
+	var spreadsheet *sheets.Spreadsheet
+	err := retry(ctx, func() (err error) {
+		spreadsheet, err = s.svc.Spreadsheets.Get(s.spreadsheetID).Fields("sheets(properties(sheetId,gridProperties),conditionalFormats)").Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var trg, cp *sheets.Sheet
+	for _, sh := range spreadsheet.Sheets {
+		switch sh.Properties.SheetId {
+		case old.SheetId:
+			trg = sh
+		case copyID:
+			cp = sh
+		}
+	}
+	if trg == nil || cp == nil {
+		return fmt.Errorf("sheet not found: %q", old.Title)
+	}
+	if cp.Properties.GridProperties == nil {
+		return fmt.Errorf("source sheet of %q has no cells to paste", old.Title)
+	}
+
+	// zero sheet IDs and indexes are valid, but omitted, unless forced.
+	whole := &sheets.GridRange{SheetId: old.SheetId, ForceSendFields: []string{"SheetId"}}
+	requests := []*sheets.Request{
+		{UnmergeCells: &sheets.UnmergeCellsRequest{Range: whole}},
+		{UpdateCells: &sheets.UpdateCellsRequest{Range: whole, Fields: "*"}},
+	}
+	for i := len(trg.ConditionalFormats) - 1; i >= 0; i-- {
+		requests = append(requests, &sheets.Request{DeleteConditionalFormatRule: &sheets.DeleteConditionalFormatRuleRequest{
+			SheetId:         old.SheetId,
+			Index:           int64(i),
+			ForceSendFields: []string{"SheetId", "Index"},
+		}})
+	}
+	grid := *cp.Properties.GridProperties
+	if tg := trg.Properties.GridProperties; tg != nil {
+		if tg.RowCount > grid.RowCount {
+			grid.RowCount = tg.RowCount
+		}
+		if tg.ColumnCount > grid.ColumnCount {
+			grid.ColumnCount = tg.ColumnCount
+		}
+	}
+	grid.ForceSendFields = []string{"FrozenRowCount", "FrozenColumnCount"}
+	requests = append(requests,
+		&sheets.Request{UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+			Properties: &sheets.SheetProperties{
+				SheetId:         old.SheetId,
+				GridProperties:  &grid,
+				ForceSendFields: []string{"SheetId"},
+			},
+			Fields: "gridProperties(rowCount,columnCount,frozenRowCount,frozenColumnCount)",
+		}},
+		// the whole copy is pasted, starting at A1.
+		&sheets.Request{CopyPaste: &sheets.CopyPasteRequest{
+			Source: &sheets.GridRange{SheetId: copyID, ForceSendFields: []string{"SheetId"}},
+			Destination: &sheets.GridRange{
+				SheetId:         old.SheetId,
+				EndRowIndex:     1,
+				EndColumnIndex:  1,
+				ForceSendFields: []string{"SheetId"},
+			},
+			PasteType: "PASTE_NORMAL",
+		}},
+		&sheets.Request{DeleteSheet: &sheets.DeleteSheetRequest{
+			SheetId:         copyID,
+			ForceSendFields: []string{"SheetId"},
+		}},
+	)
+	rb := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+	// the conditional formatting rules are deleted by their indexes, so the
+	// batch is not repeated, if the copy, deleted by the same batch, is gone.
+	return retryChecked(ctx, func() error {
+		_, err := s.svc.Spreadsheets.BatchUpdate(s.spreadsheetID, rb).Context(ctx).Do()
+		return err
+	}, func() (bool, error) {
+		exists, err := s.hasSheetID(ctx, copyID)
+		return !exists, err
+	})
+}
+
+// replaceSheet replaces the sheet old with the sheet copyID.  The copy is
+// duplicated with the ID, title and index of the old sheet, so that the
+// links to the sheet (by its ID) stay intact.  The references to the old
+// sheet in other sheets' formulas become #REF!, as the sheet is deleted.
+// The changes are made in one batch, which either succeeds or fails as a
+// whole.
+func (s *sheetSvc) replaceSheet(ctx context.Context, old *sheets.SheetProperties, copyID int64) error {
+	// zero sheet ID and index are valid, but omitted, unless forced.
+	requests := []*sheets.Request{
+		{DeleteSheet: &sheets.DeleteSheetRequest{
+			SheetId:         old.SheetId,
+			ForceSendFields: []string{"SheetId"},
+		}},
+		{DuplicateSheet: &sheets.DuplicateSheetRequest{
+			SourceSheetId:    copyID,
+			NewSheetId:       old.SheetId,
+			NewSheetName:     old.Title,
+			InsertSheetIndex: old.Index,
+			ForceSendFields:  []string{"NewSheetId", "InsertSheetIndex"},
+		}},
+		{DeleteSheet: &sheets.DeleteSheetRequest{
+			SheetId:         copyID,
+			ForceSendFields: []string{"SheetId"},
+		}},
+	}
+	rb := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+	// the old sheet is gone after the first successful request, so it is
+	// not repeated, if the copy, deleted by the same batch, is gone.
+	return retryChecked(ctx, func() error {
+		_, err := s.svc.Spreadsheets.BatchUpdate(s.spreadsheetID, rb).Context(ctx).Do()
+		return err
+	}, func() (bool, error) {
+		exists, err := s.hasSheetID(ctx, copyID)
+		return !exists, err
+	})
+}
+
+// deleteSheet deletes the sheet with the ID.
+func (s *sheetSvc) deleteSheet(ctx context.Context, sheetID int64) error {
+	rb := &sheets.BatchUpdateSpreadsheetRequest{Requests: []*sheets.Request{
+		{DeleteSheet: &sheets.DeleteSheetRequest{SheetId: sheetID, ForceSendFields: []string{"SheetId"}}},
+	}}
+	// deleting the sheet twice fails.
+	return retryChecked(ctx, func() error {
+		_, err := s.svc.Spreadsheets.BatchUpdate(s.spreadsheetID, rb).Context(ctx).Do()
+		return err
+	}, func() (bool, error) {
+		exists, err := s.hasSheetID(ctx, sheetID)
+		return !exists, err
+	})
+}
 
-	resp, err := s.svc.Spreadsheets.Values.
-		BatchUpdate(s.spreadsheetID, rb).
-		Context(context.TODO()).
-		Do()
+// deleteRows deletes the rows of the sheet.  Rows are zero-based indexes,
+// and must be sorted in descending order, so that deletion of one row does
+// not shift the rows that are deleted after it.  Repeated deletion would
+// delete the wrong rows, so if the request fails, and might have been
+// processed, the rows that are still to be deleted are looked up again with
+// find.
+func (s *sheetSvc) deleteRows(ctx context.Context, title string, rows []int, find func() ([]int, error)) error {
+	id, err := s.sheetID(ctx, title)
+	if err != nil {
+		return err
+	}
+	return retryChecked(ctx, func() error {
+		requests := make([]*sheets.Request, len(rows))
+		for i, r := range rows {
+			requests[i] = &sheets.Request{DeleteDimension: &sheets.DeleteDimensionRequest{
+				Range: &sheets.DimensionRange{
+					SheetId:    id,
+					Dimension:  "ROWS",
+					StartIndex: int64(r),
+					EndIndex:   int64(r) + 1,
+				},
+			}}
+		}
+		rb := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+		_, err := s.svc.Spreadsheets.BatchUpdate(s.spreadsheetID, rb).Context(ctx).Do()
+		return err
+	}, func() (bool, error) {
+		var err error
+		rows, err = find()
+		return len(rows) == 0, err
+	})
+}
+
+// append appends the data after the table that is found at the data range.
+func (s *sheetSvc) append(ctx context.Context, data *sheets.ValueRange) (*sheets.AppendValuesResponse, error) {
+	const insertDataOption = "INSERT_ROWS" // do not overwrite the data below the table
+
+	// Reference: https://developers.google.com/sheets/api/reference/rest/v4/spreadsheets.values/append
+	// repeated append would duplicate the rows, so the number of rows of
+	// the sheet is compared with the one before the append, to tell if the
+	// failed request has appended the rows.
+	title := sheetName(data.Range)
+	before, err := s.rowCount(ctx, title)
+	if err != nil {
+		return nil, err
+	}
+	var resp *sheets.AppendValuesResponse
+	err = retryChecked(ctx, func() (err error) {
+		resp, err = s.svc.Spreadsheets.Values.
+			Append(s.spreadsheetID, data.Range, data).
+			ValueInputOption(s.opts.inputOption()).
+			InsertDataOption(insertDataOption).
+			Context(ctx).
+			Do()
+		return err
+	}, func() (bool, error) {
+		after, err := s.rowCount(ctx, title)
+		if err != nil {
+			return false, err
+		}
+		switch after {
+		case before:
+			return false, nil
+		case before + len(data.Values):
+			resp = &sheets.AppendValuesResponse{Updates: &sheets.UpdateValuesResponse{
+				UpdatedRows:  int64(len(data.Values)),
+				UpdatedCells: int64(countCells(data.Values)),
+			}}
+			return true, nil
+		}
+		return false, fmt.Errorf("%w: sheet %q had %d rows, now has %d", errAppendUnknown, title, before, after)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -79,10 +461,37 @@ func (s *sheetSvc) update(data *sheets.ValueRange) (*sheets.BatchUpdateValuesRes
 	return resp, nil
 }
 
-func (s *sheetSvc) validate(sheets []string, create bool) (*sheets.Spreadsheet, error) {
+// rowCount returns the number of rows of the sheet up to the last row with
+// data.
+func (s *sheetSvc) rowCount(ctx context.Context, title string) (int, error) {
+	vr, err := s.get(ctx, quoteSheet(title))
+	if err != nil {
+		return 0, err
+	}
+	return len(vr.Values), nil
+}
+
+// hasData returns true if the first row of the address contains any values.
+func (s *sheetSvc) hasData(ctx context.Context, address string) (bool, error) {
+	firstRow, err := firstRowRange(address)
+	if err != nil {
+		return false, err
+	}
+	vr, err := s.get(ctx, firstRow)
+	if err != nil {
+		return false, err
+	}
+	return len(vr.Values) > 0, nil
+}
+
+func (s *sheetSvc) validate(ctx context.Context, addresses []string, create bool) (*sheets.Spreadsheet, error) {
 	// getting information about the spreadsheet
 	log.Printf("  * retrieving information about the spreadsheet")
-	spreadsheet, err := s.svc.Spreadsheets.Get(s.spreadsheetID).Do()
+	var spreadsheet *sheets.Spreadsheet
+	err := retry(ctx, func() (err error) {
+		spreadsheet, err = s.svc.Spreadsheets.Get(s.spreadsheetID).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -90,11 +499,12 @@ func (s *sheetSvc) validate(sheets []string, create bool) (*sheets.Spreadsheet,
 	log.Printf("  * validating target configuration")
 	// need to ensure that all provided addresses are referencing valid
 	// sheets
-	for _, address := range sheets {
+	for _, address := range addresses {
 		valid := false
 
+		title := sheetName(address)
 		for _, existing := range spreadsheet.Sheets {
-			if strings.HasPrefix(address, existing.Properties.Title) {
+			if title == existing.Properties.Title {
 				valid = true
 				break
 			}
@@ -103,7 +513,7 @@ func (s *sheetSvc) validate(sheets []string, create bool) (*sheets.Spreadsheet,
 			continue
 		}
 		if !valid && create {
-			if err := s.addSheet(address); err != nil {
+			if err := s.addSheet(ctx, address); err != nil {
 				return nil, err
 			}
 		} else {
@@ -0,0 +1,108 @@
+package xls2sheets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// flakySheet is the fake Sheets API with one spreadsheet, that fails the
+// first write request with 503.  If applied is set, the failed request is
+// processed nevertheless, as if the response was lost.
+type flakySheet struct {
+	mu      sync.Mutex
+	applied bool
+	failed  bool
+	writes  int
+	titles  []string
+	rows    [][]interface{}
+}
+
+func (fs *flakySheet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if r.Method == http.MethodGet {
+		if strings.Contains(r.URL.Path, "/values/") {
+			json.NewEncoder(w).Encode(sheets.ValueRange{Values: fs.rows})
+			return
+		}
+		var list []interface{}
+		for i, title := range fs.titles {
+			list = append(list, map[string]interface{}{"properties": map[string]interface{}{"sheetId": i, "title": title, "index": i}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sheets": list})
+		return
+	}
+	fs.writes++
+	fail := !fs.failed
+	fs.failed = true
+	if fail && !fs.applied {
+		http.Error(w, "backend error", http.StatusServiceUnavailable)
+		return
+	}
+	switch {
+	case strings.HasSuffix(r.URL.Path, ":batchUpdate"):
+		var rb sheets.BatchUpdateSpreadsheetRequest
+		json.NewDecoder(r.Body).Decode(&rb)
+		for _, req := range rb.Requests {
+			if req.AddSheet != nil {
+				fs.titles = append(fs.titles, req.AddSheet.Properties.Title)
+			}
+		}
+	case strings.HasSuffix(r.URL.Path, ":append"):
+		var vr sheets.ValueRange
+		json.NewDecoder(r.Body).Decode(&vr)
+		fs.rows = append(fs.rows, vr.Values...)
+	}
+	if fail {
+		http.Error(w, "backend error", http.StatusServiceUnavailable)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{})
+}
+
+func Test_sheetSvc_retryChecked(t *testing.T) {
+	ctx := withRetryPolicy(context.Background(), RetryPolicy{MaxAttempts: 3, MinDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	tests := []struct {
+		name       string
+		applied    bool
+		wantWrites int
+	}{
+		{"not applied", false, 2},
+		{"applied", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run("addSheet "+tt.name, func(t *testing.T) {
+			fs := &flakySheet{applied: tt.applied, titles: []string{"Data"}}
+			svc, err := newSheetSvc(apiClient(t, fs), "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := svc.addSheet(ctx, "New"); err != nil {
+				t.Fatal(err)
+			}
+			if fs.writes != tt.wantWrites || len(fs.titles) != 2 {
+				t.Errorf("addSheet() sent %d requests, sheets: %q, want %d requests and one new sheet", fs.writes, fs.titles, tt.wantWrites)
+			}
+		})
+		t.Run("append "+tt.name, func(t *testing.T) {
+			fs := &flakySheet{applied: tt.applied, rows: [][]interface{}{{"id"}, {"1"}}}
+			svc, err := newSheetSvc(apiClient(t, fs), "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := svc.append(ctx, &sheets.ValueRange{Range: "Data", Values: [][]interface{}{{"2"}, {"3"}}}); err != nil {
+				t.Fatal(err)
+			}
+			if fs.writes != tt.wantWrites || len(fs.rows) != 4 {
+				t.Errorf("append() sent %d requests, rows: %v, want %d requests and 4 rows", fs.writes, fs.rows, tt.wantWrites)
+			}
+		})
+	}
+}
@@ -1,7 +1,12 @@
 package xls2sheets
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -43,22 +48,33 @@ var converters = map[srcType]sourcer{
 
 // sourcer is the source file interface
 type sourcer interface {
-	// convert converts the source document to google sheets format and
-	// returns the drive.fileID (same as sheetID)
-	convert(client *http.Client, loc string) (sheetID string, err error)
+	// convert converts the source document to google sheets format, named
+	// name, and returns the drive.fileID (same as sheetID)
+	convert(ctx context.Context, client *http.Client, loc string, name string) (sheetID string, err error)
+}
+
+// opener is implemented by the source types that can be read locally.
+type opener interface {
+	// open opens the source document for reading.
+	open(ctx context.Context, loc string) (io.ReadCloser, error)
 }
 
 // different source types
 type file struct{}
-type web struct{}
 type gsheet struct{}
 
+// web is the remote file source, opts are the HTTP options of the source.
+type web struct {
+	opts *HTTPOptions
+}
+
 var gsheetRe = regexp.MustCompile(`[-\w]{25,}$`)
 
 // Errors.
 var (
 	errNothingToDelete = errors.New("delete called before upload")
 	errUnknown         = errors.New("unknown file type or location")
+	errNotLocal        = errors.New("source can not be read locally")
 )
 
 func fileType(loc string) srcType {
@@ -90,6 +106,15 @@ func filename(loc string) (string, error) {
 	return filepath.Join(url.Host, url.Path), nil
 }
 
+// converter returns the converter for the source type.
+func (sf *Source) converter(typ srcType) (sourcer, bool) {
+	if typ == srcWeb {
+		return web{opts: sf.HTTP}, true
+	}
+	c, ok := converters[typ]
+	return c, ok
+}
+
 // init initialises and does some checks
 func (sf *Source) init() error {
 	sf.FileLocation = os.ExpandEnv(sf.FileLocation)
@@ -104,6 +129,12 @@ func (sf *Source) init() error {
 // Process gets the file onto google drive, if needed (i.e. it not google
 // spreadsheet).  Returns the file ID on google drive.
 func (sf *Source) Process(client *http.Client) (string, error) {
+	return sf.ProcessContext(context.Background(), client)
+}
+
+// ProcessContext gets the file onto google drive, if needed (i.e. it not
+// google spreadsheet).  Returns the file ID on google drive.
+func (sf *Source) ProcessContext(ctx context.Context, client *http.Client) (string, error) {
 	// initialise
 	if err := sf.init(); err != nil {
 		return "", err
@@ -116,25 +147,151 @@ func (sf *Source) Process(client *http.Client) (string, error) {
 	log.Printf("+ type detected as: %s", typ)
 
 	// getting appropriate converter for the source type
-	c, ok := converters[typ]
+	c, ok := sf.converter(typ)
 	if !ok {
 		return "", errUnknown
 	}
 
-	log.Printf("+ opening: %s", sf.FileLocation)
-	id, err := c.convert(client, sf.FileLocation)
+	var (
+		id  string
+		err error
+	)
+	if sf.data != nil {
+		// the file was already fetched by check.
+		id, err = upload(ctx, client, bytes.NewReader(sf.data), sf.FileLocation, sf.tempName)
+		sf.data = nil
+	} else {
+		log.Printf("+ opening: %s", redactURL(sf.FileLocation))
+		id, err = c.convert(ctx, client, sf.FileLocation, sf.tempName)
+	}
 	if err != nil {
 		return "", err
 	}
 
-	// saving fileID, delete will need it.
-	sf.fileID = id
+	// saving fileID of the uploaded file, delete will need it.  Google
+	// Spreadsheet sources are read in place and must never be deleted.
+	if typ != srcGSheet {
+		sf.fileID = id
+	}
 
 	return id, nil
 }
 
+// load reads the source file into memory, so that values can be copied from
+// it without the intermediate spreadsheet.
+func (sf *Source) load(ctx context.Context) (*workbook, error) {
+	if err := sf.init(); err != nil {
+		return nil, err
+	}
+	typ := fileType(sf.FileLocation)
+	if typ == srcUnknown {
+		return nil, errUnknown
+	}
+	log.Printf("+ type detected as: %s", typ)
+
+	c, _ := sf.converter(typ)
+	o, ok := c.(opener)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", typ, errNotLocal)
+	}
+
+	if sf.data != nil {
+		// the file was already fetched by check.
+		data := sf.data
+		sf.data = nil
+		return readWorkbook(bytes.NewReader(data), sf.Ext(), sf.tempName)
+	}
+
+	log.Printf("+ reading: %s", redactURL(sf.FileLocation))
+	f, err := o.open(ctx, sf.FileLocation)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// csv has only one sheet, and it has the same name as set in init.
+	return readWorkbook(f, sf.Ext(), sf.tempName)
+}
+
+// check fetches the source and returns its state.  If prev is not nil,
+// the conditional request is sent for the remote file, and prev is returned
+// if the server reports that the file has not been modified.  The contents
+// of the file are kept, so that ProcessContext or load would not fetch it
+// again.
+func (sf *Source) check(ctx context.Context, client *http.Client, prev *SourceState) (*SourceState, error) {
+	if err := sf.init(); err != nil {
+		return nil, err
+	}
+	// the location is stored redacted, as it may contain secrets.
+	location := redactURL(sf.FileLocation)
+	if prev != nil && prev.Location != location {
+		prev = nil
+	}
+	st := &SourceState{Location: location}
+
+	var data []byte
+	switch typ := fileType(sf.FileLocation); typ {
+	case srcWeb:
+		header := make(http.Header)
+		if prev != nil && prev.ETag != "" {
+			header.Set("If-None-Match", prev.ETag)
+		}
+		if prev != nil && prev.LastModified != "" {
+			header.Set("If-Modified-Since", prev.LastModified)
+		}
+		log.Printf("+ checking: %s", redactURL(sf.FileLocation))
+		resp, body, err := sf.HTTP.fetch(ctx, sf.FileLocation, header)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotModified && prev != nil {
+			unchanged := *prev
+			return &unchanged, nil
+		}
+		st.ETag = resp.Header.Get("ETag")
+		st.LastModified = resp.Header.Get("Last-Modified")
+		data = body
+	case srcFile:
+		log.Printf("+ checking: %s", redactURL(sf.FileLocation))
+		f, err := file{}.open(ctx, sf.FileLocation)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return nil, err
+		}
+	case srcGSheet:
+		srv, err := drive.New(client)
+		if err != nil {
+			return nil, err
+		}
+		var f *drive.File
+		if err := retry(ctx, func() (err error) {
+			f, err = srv.Files.Get(sf.FileLocation).Fields("modifiedTime").SupportsAllDrives(true).Context(ctx).Do()
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		st.ModifiedTime = f.ModifiedTime
+		return st, nil
+	default:
+		return nil, errUnknown
+	}
+
+	sum := sha256.Sum256(data)
+	st.Hash = hex.EncodeToString(sum[:])
+	sf.data = data
+	return st, nil
+}
+
 // Delete deletes the temporary file from the google drive.
 func (sf *Source) Delete(client *http.Client) error {
+	return sf.DeleteContext(context.Background(), client)
+}
+
+// DeleteContext deletes the temporary file from the google drive.
+func (sf *Source) DeleteContext(ctx context.Context, client *http.Client) error {
 	// if the fileID is nil, then upload function hasn't been called yet
 	if sf.fileID == "" {
 		return errNothingToDelete
@@ -143,9 +300,16 @@ func (sf *Source) Delete(client *http.Client) error {
 	if err != nil {
 		return err
 	}
-	if err := srv.Files.Delete(sf.fileID).Do(); err != nil {
+	if err := retry(ctx, func() error {
+		return srv.Files.Delete(sf.fileID).SupportsAllDrives(true).Context(ctx).Do()
+	}); err != nil {
 		return err
 	}
+	if jr, _ := journalFrom(ctx); jr != nil {
+		if err := jr.forget(sf.fileID); err != nil {
+			log.Printf("+ failed to update the journal: %s", err)
+		}
+	}
 	// clearing the file ID so that consequent calls would now that the file
 	// does not exist
 	sf.fileID = ""
@@ -162,78 +326,86 @@ func (sf *Source) MIMEtype() string {
 	return mime.TypeByExtension(sf.Ext())
 }
 
-// upload uploads the source data to temporary google spreadsheet on
-// google drive, so that it would be possible to copy data from it.
-func (sf *Source) upload(client *http.Client, sourceData io.Reader) (string, error) {
-	srv, err := drive.New(client)
-	if err != nil {
-		return "", err
-	}
-	// target file name and MIME type format, so that Google Drive would
-	// convert the source file to Google Sheets format
-	file := drive.File{
-		Name:     sf.tempName,
-		MimeType: gsheetMIME,
+// generateName generates a temporary filename to save on Google Drive.  The
+// random suffix makes the names of the files, uploaded within the same
+// second by the parallel tasks or runs, unique, so that the file could be
+// found by name.
+func generateName(prefix string, extension string) string {
+	epoch := time.Now().Unix()
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		// unlikely, but the name must still be unique.
+		binary.BigEndian.PutUint32(suffix[:], uint32(time.Now().UnixNano()))
 	}
-	// content type is necessary for google drive to convert the file to
-	hFile, err := srv.Files.
-		Create(&file).
-		Media(
-			sourceData, // source file data
-			googleapi.ContentType(sf.MIMEtype()),
-		).
-		Do()
+	return fmt.Sprintf("%s%d-%x%s", prefix, epoch, suffix, extension)
+}
+
+func (w web) convert(ctx context.Context, client *http.Client, loc string, name string) (string, error) {
+	f, err := w.open(ctx, loc)
 	if err != nil {
 		return "", err
 	}
-	sf.fileID = hFile.Id
-
-	return file.Id, err
+	defer f.Close()
+	return upload(ctx, client, f, loc, name)
 }
 
-// generateName generates a temporary filename to save on Google Drive.
-func generateName(prefix string, extension string) string {
-	epoch := time.Now().Unix()
-	return fmt.Sprintf("%s%d%s", prefix, epoch, extension)
+func (w web) open(ctx context.Context, loc string) (io.ReadCloser, error) {
+	_, data, err := w.opts.fetch(ctx, loc, nil)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
 }
 
-func (web) convert(client *http.Client, loc string) (string, error) {
-	f, err := fetchFromWeb(loc)
+func (fl file) convert(ctx context.Context, client *http.Client, loc string, name string) (string, error) {
+	f, err := fl.open(ctx, loc)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
-	return upload(client, f, loc)
+
+	return upload(ctx, client, f, loc, name)
 }
 
-func (file) convert(client *http.Client, loc string) (string, error) {
+func (file) open(_ context.Context, loc string) (io.ReadCloser, error) {
 	if strings.HasPrefix(strings.ToLower(loc), "file://") {
 		var err error
 		if loc, err = filename(loc); err != nil {
-			return "", err
+			return nil, err
 		}
 	}
-	_, err := os.Stat(loc)
-	if err != nil {
-		return "", err
-	}
+	return os.Open(loc)
+}
 
-	f, err := os.Open(loc)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
+func (gsheet) convert(_ context.Context, client *http.Client, loc string, _ string) (string, error) {
+	return loc, nil
+}
+
+// tempFolderKey is the context key for the temporary files folder.
+type tempFolderKey struct{}
 
-	return upload(client, f, loc)
+// withTempFolder returns the context that carries the ID of the Drive folder
+// for the temporary files.  Empty folder leaves the parent folder unchanged.
+func withTempFolder(ctx context.Context, folder string) context.Context {
+	if folder == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tempFolderKey{}, folder)
 }
 
-func (gsheet) convert(client *http.Client, loc string) (string, error) {
-	return loc, nil
+// tempFolder returns the ID of the folder for the temporary files from the
+// context, or empty string, if the files are created in My Drive root.
+func tempFolder(ctx context.Context) string {
+	folder, _ := ctx.Value(tempFolderKey{}).(string)
+	return folder
 }
 
-// upload uploads the source data to temporary google spreadsheet on
-// google drive, so that it would be possible to copy data from it.
-func upload(client *http.Client, sourceData io.Reader, srcName string) (string, error) {
+// upload uploads the source data to temporary google spreadsheet, named
+// name, on google drive, so that it would be possible to copy data from it.
+// srcName is the name of the source file, that defines its type.  The
+// spreadsheet is created in the folder from the context, which may be on
+// the shared drive.
+func upload(ctx context.Context, client *http.Client, sourceData io.Reader, srcName string, name string) (string, error) {
 	srv, err := drive.New(client)
 	if err != nil {
 		return "", err
@@ -241,38 +413,60 @@ func upload(client *http.Client, sourceData io.Reader, srcName string) (string,
 	// target file name and MIME type format, so that Google Drive would
 	// convert the source excel file to Google Sheets format
 	file := drive.File{
-		Name:     generateName(tempFilePrefix, filepath.Ext(srcName)),
+		Name:     name,
 		MimeType: gsheetMIME,
 	}
-	// content type is necessary for google drive to convert the file to
-	hFile, err := srv.Files.
-		Create(&file).
-		Media(
-			sourceData, // source file data
-			googleapi.ContentType(mime.TypeByExtension(filepath.Ext(srcName))), // source file MIME type
-		).
-		Do()
+	folder := tempFolder(ctx)
+	if folder != "" {
+		file.Parents = []string{folder}
+	}
+	// the data is read into memory, so that the upload could be retried.
+	data, err := io.ReadAll(sourceData)
 	if err != nil {
 		return "", err
 	}
-	return hFile.Id, err
-}
-
-// fetchFromWeb loads a source file on a remote server
-func fetchFromWeb(uri string) (io.ReadCloser, error) {
-	tlsConfig := tls.Config{
-		InsecureSkipVerify: true,
+	// the name is recorded before the upload, so that the file could be
+	// found if the program crashes before the upload returns.
+	jr, profile := journalFrom(ctx)
+	var entry *JournalEntry
+	if jr != nil {
+		if entry, err = jr.add(file.Name, profile, folder); err != nil {
+			return "", fmt.Errorf("journal: %w", err)
+		}
 	}
-	transport := &http.Transport{TLSClientConfig: &tlsConfig}
-
-	insecureClient := &http.Client{Transport: transport}
-	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	// content type is necessary for google drive to convert the file to.
+	// The request that has failed may still have created the file, so the
+	// files with the same name are deleted before the upload is repeated,
+	// not to leave the extra copies.  The name is unique, so there are no
+	// other files with it.
+	var hFile *drive.File
+	err = retryChecked(ctx, func() (err error) {
+		hFile, err = srv.Files.
+			Create(&file).
+			Media(
+				bytes.NewReader(data), // source file data
+				googleapi.ContentType(mime.TypeByExtension(filepath.Ext(srcName))), // source file MIME type
+			).
+			SupportsAllDrives(true).
+			Context(ctx).
+			Do()
+		return err
+	}, func() (bool, error) {
+		log.Printf("    * upload failed, deleting the partial uploads of %s", file.Name)
+		return false, deleteLeftover(ctx, client, JournalEntry{Name: file.Name, Folder: folder})
+	})
 	if err != nil {
-		return nil, err
+		if entry != nil {
+			// the file might still have been created, leaving the entry
+			// for the next start to purge.
+			log.Printf("+ temporary file %s is left in the journal", file.Name)
+		}
+		return "", err
 	}
-	resp, err := insecureClient.Do(req)
-	if err != nil {
-		return nil, err
+	if entry != nil {
+		if err := jr.setID(entry, hFile.Id); err != nil {
+			log.Printf("+ failed to update the journal: %s", err)
+		}
 	}
-	return resp.Body, nil
+	return hFile.Id, err
 }
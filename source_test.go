@@ -1,35 +1,53 @@
 package xls2sheets
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func Test_generateName(t *testing.T) {
-	type args struct {
+	epoch := strconv.Itoa(int(time.Now().Unix()))
+	tests := []struct {
+		name      string
 		prefix    string
 		extension string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
+		want      *regexp.Regexp
 	}{
-		{"with prefix", args{"prefix", ".xlsx"}, "prefix" + strconv.Itoa(int(time.Now().Unix())) + ".xlsx"},
-		{"no prefix", args{"", ""}, strconv.Itoa(int(time.Now().Unix())) + ""},
+		{"with prefix", "prefix", ".xlsx", regexp.MustCompile(`^prefix` + epoch + `-[0-9a-f]{8}\.xlsx$`)},
+		{"no prefix", "", "", regexp.MustCompile(`^` + epoch + `-[0-9a-f]{8}$`)},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := generateName(tt.args.prefix, tt.args.extension); got != tt.want {
+			if got := generateName(tt.prefix, tt.extension); !tt.want.MatchString(got) {
 				t.Errorf("generateName() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func Test_generateName_unique(t *testing.T) {
+	// names generated within the same second by the parallel tasks must not
+	// collide.
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		name := generateName(tempFilePrefix, ".csv")
+		if seen[name] {
+			t.Fatalf("generateName() returned %q twice", name)
+		}
+		seen[name] = true
+	}
+}
+
 func Test_filename(t *testing.T) {
 	type args struct {
 		loc string
@@ -90,3 +108,82 @@ func Test_fileType(t *testing.T) {
 		})
 	}
 }
+
+func Test_upload(t *testing.T) {
+	tests := []struct {
+		name        string
+		folder      string
+		wantParents bool
+	}{
+		{"my drive", "", false},
+		{"shared drive folder", "folder-id", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd := &journalDrive{}
+			ctx := withTempFolder(context.Background(), tt.folder)
+			if _, err := upload(ctx, apiClient(t, fd), strings.NewReader("a,b\n"), "data.csv", generateName(tempFilePrefix, ".csv")); err != nil {
+				t.Fatal(err)
+			}
+			if got := fd.uploadQuery.Get("supportsAllDrives"); got != "true" {
+				t.Errorf("supportsAllDrives = %q, want true", got)
+			}
+			if got := strings.Contains(fd.uploadBody, `"parents":["folder-id"]`); got != tt.wantParents {
+				t.Errorf("parents set = %v, want %v, body:\n%s", got, tt.wantParents, fd.uploadBody)
+			}
+		})
+	}
+}
+
+func TestSource_DeleteContext_gsheet(t *testing.T) {
+	// the Google Spreadsheet source is read in place, it is not a temporary
+	// file and must never be deleted.
+	ctx := context.Background()
+	fd := &journalDrive{}
+	client := apiClient(t, fd)
+	sf := &Source{FileLocation: "1lqbZm_TCsqcOTvOHPjG2CvZ6PpmDtBg_6qe-J1I91sk"}
+	id, err := sf.ProcessContext(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != sf.FileLocation {
+		t.Errorf("ProcessContext() = %q, want %q", id, sf.FileLocation)
+	}
+	if err := sf.DeleteContext(ctx, client); !errors.Is(err, errNothingToDelete) {
+		t.Errorf("DeleteContext() error = %v, want %v", err, errNothingToDelete)
+	}
+	if len(fd.deleted) > 0 {
+		t.Errorf("DeleteContext() deleted the source spreadsheet: %v", fd.deleted)
+	}
+}
+
+func Test_upload_retry(t *testing.T) {
+	// the failed upload has created the file, it must be deleted before the
+	// upload is repeated, not to leave the extra copies on the Drive.
+	name := generateName(tempFilePrefix, ".csv")
+	fd := &journalDrive{}
+	var failed bool
+	client := apiClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && !failed {
+			failed = true
+			fd.names = map[string]string{name: "partial-id"}
+			http.Error(w, "backend error", http.StatusServiceUnavailable)
+			return
+		}
+		fd.ServeHTTP(w, r)
+	}))
+	ctx := withRetryPolicy(context.Background(), RetryPolicy{MaxAttempts: 3, MinDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	id, err := upload(ctx, client, strings.NewReader("a,b\n"), "data.csv", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "new" {
+		t.Errorf("upload() = %q, want %q", id, "new")
+	}
+	if diff := cmp.Diff([]string{"partial-id"}, fd.deleted); diff != "" {
+		t.Errorf("deleted (-want,+got):\n%s", diff)
+	}
+	if len(fd.created) != 1 {
+		t.Errorf("upload() created %d files after the failure, want 1", len(fd.created))
+	}
+}
@@ -0,0 +1,144 @@
+package xls2sheets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const stateFileMode = 0600
+
+// State keeps the state of the task sources after the last successful run,
+// so that the tasks with unchanged sources could be skipped.
+type State struct {
+	filename string
+
+	mu      sync.Mutex
+	sources map[string]*SourceState // by task name
+}
+
+// SourceState is the state of the task source.
+type SourceState struct {
+	// Location and SpreadsheetID are the source location and target
+	// spreadsheet of the task, if any of them changes, the source is
+	// considered to be changed.
+	Location      string `json:"location"`
+	SpreadsheetID string `json:"spreadsheet_id"`
+	// ETag and LastModified are the HTTP headers of the remote file.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// Hash is the SHA-256 of the file contents.
+	Hash string `json:"hash,omitempty"`
+	// ModifiedTime is the modification time of the Google Spreadsheet.
+	ModifiedTime string `json:"modified_time,omitempty"`
+	// Config is the SHA-256 of the task source and target configuration,
+	// if it changes, the task is run again.
+	Config string `json:"config,omitempty"`
+}
+
+// LoadState loads the state from the file.  If the file does not exist, the
+// empty state is returned, it is created on Save.
+func LoadState(filename string) (*State, error) {
+	st := &State{filename: filename, sources: make(map[string]*SourceState)}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return st, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st.sources); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Save saves the state to the file.
+func (st *State) Save() error {
+	st.mu.Lock()
+	data, err := json.MarshalIndent(st.sources, "", "  ")
+	st.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(st.filename, data)
+}
+
+// writeFileAtomic writes the data to the temporary file first, and renames
+// it to filename, so that the file is not lost or truncated if the program
+// is interrupted.  The directory is created if it does not exist.
+func writeFileAtomic(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, stateFileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// get returns the state of the task source, or nil if it's not known.
+func (st *State) get(taskName string) *SourceState {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.sources[taskName]
+}
+
+// set sets the state of the task source.
+func (st *State) set(taskName string, ss *SourceState) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.sources[taskName] = ss
+}
+
+// unchanged returns true if the source state is the same as prev.
+func (ss *SourceState) unchanged(prev *SourceState) bool {
+	if prev == nil || ss.Location != prev.Location || ss.SpreadsheetID != prev.SpreadsheetID || ss.Config != prev.Config {
+		return false
+	}
+	switch {
+	case ss.Hash != "":
+		return ss.Hash == prev.Hash
+	case ss.ModifiedTime != "":
+		return ss.ModifiedTime == prev.ModifiedTime
+	}
+	return false
+}
+
+// configHash returns the SHA-256 of the task source and target
+// configuration, the resolved profiles and the temporary folder.  The HTTP
+// options of the source are not included, as they may contain the secrets,
+// and the fetched contents are compared anyway.
+func (task *Task) configHash() (string, error) {
+	src := *task.Source
+	src.HTTP = nil
+	data, err := json.Marshal(struct {
+		Source        *Source
+		Target        *Target
+		SourceProfile string
+		TargetProfile string
+		TempFolderID  string
+	}{&src, task.Target, task.sourceProfile(), task.targetProfile(), task.TempFolderID})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
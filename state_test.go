@@ -0,0 +1,137 @@
+package xls2sheets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestState_Save(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state", "job.json")
+	st, err := LoadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := st.get("01_rates"); got != nil {
+		t.Errorf("State.get() = %v, want nil", got)
+	}
+	want := &SourceState{Location: "rates.csv", SpreadsheetID: "sheet-id", Hash: "abc"}
+	st.set("01_rates", want)
+	if err := st.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, loaded.get("01_rates")); diff != "" {
+		t.Errorf("LoadState() mismatch (-want,+got):\n%s", diff)
+	}
+}
+
+func TestSourceState_unchanged(t *testing.T) {
+	prev := &SourceState{Location: "rates.csv", SpreadsheetID: "sheet-id", Hash: "abc"}
+	tests := []struct {
+		name string
+		ss   *SourceState
+		prev *SourceState
+		want bool
+	}{
+		{"no state", &SourceState{Location: "rates.csv", SpreadsheetID: "sheet-id", Hash: "abc"}, nil, false},
+		{"same", &SourceState{Location: "rates.csv", SpreadsheetID: "sheet-id", Hash: "abc"}, prev, true},
+		{"contents", &SourceState{Location: "rates.csv", SpreadsheetID: "sheet-id", Hash: "def"}, prev, false},
+		{"target", &SourceState{Location: "rates.csv", SpreadsheetID: "other", Hash: "abc"}, prev, false},
+		{"location", &SourceState{Location: "other.csv", SpreadsheetID: "sheet-id", Hash: "abc"}, prev, false},
+		{"modified time", &SourceState{ModifiedTime: "2020-01-01T00:00:00Z"}, &SourceState{ModifiedTime: "2020-01-01T00:00:00Z"}, true},
+		{"config", &SourceState{Location: "rates.csv", SpreadsheetID: "sheet-id", Hash: "abc", Config: "new"}, prev, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ss.unchanged(tt.prev); got != tt.want {
+				t.Errorf("SourceState.unchanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSource_check(t *testing.T) {
+	const etag = `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("a,b\n1,2\n"))
+	}))
+	defer srv.Close()
+
+	sf := &Source{FileLocation: srv.URL + "/rates.csv"}
+	st, err := sf.check(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ETag != etag || st.Hash == "" {
+		t.Errorf("Source.check() unexpected state: %+v", st)
+	}
+	if string(sf.data) != "a,b\n1,2\n" {
+		t.Errorf("Source.check() unexpected data: %q", sf.data)
+	}
+
+	sf = &Source{FileLocation: srv.URL + "/rates.csv"}
+	got, err := sf.check(context.Background(), nil, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(st, got); diff != "" {
+		t.Errorf("Source.check() mismatch (-want,+got):\n%s", diff)
+	}
+	if sf.data != nil {
+		t.Errorf("Source.check() unexpected data for unmodified file: %q", sf.data)
+	}
+}
+
+func TestTask_checkSource_config(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rates.csv")
+	if err := os.WriteFile(filename, []byte("a,b\n1,2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	newTask := func() *Task {
+		return &Task{
+			Source: &Source{FileLocation: filename},
+			Target: &Target{SpreadsheetID: "sheet-id", SheetAddress: []string{"Rates!A1"}},
+		}
+	}
+	ctx := context.Background()
+	st, _, err := newTask().checkSource(ctx, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, unchanged, err := newTask().checkSource(ctx, nil, st); err != nil || !unchanged {
+		t.Fatalf("checkSource() = %v, %v, want unchanged", unchanged, err)
+	}
+	// the edited configuration must run the task again.
+	tests := []struct {
+		name string
+		edit func(task *Task)
+	}{
+		{"target mode", func(task *Task) { task.Target.Mode = ModeAppend }},
+		{"profile", func(task *Task) { task.Profile = "work" }},
+		{"target profile", func(task *Task) { task.Target.Profile = "work" }},
+		{"temp folder", func(task *Task) { task.TempFolderID = "folder-id" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := newTask()
+			tt.edit(task)
+			if _, unchanged, err := task.checkSource(ctx, nil, st); err != nil || unchanged {
+				t.Errorf("checkSource() = %v, %v, want changed", unchanged, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package xls2sheets
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -14,8 +15,6 @@ import (
 	"google.golang.org/api/sheets/v4"
 )
 
-const userEntered = "USER_ENTERED"
-
 const (
 	bakSuffix   = ".bak" // backup file suffix, will be added to file
 	bakFileMode = 0666
@@ -24,6 +23,7 @@ const (
 var (
 	errEmptyRange     = errors.New("empty source and/or target ranges")
 	errLengthMismatch = errors.New("source and target ranges have different lengths")
+	errUnknownMode    = errors.New("unknown target mode")
 )
 
 func debugPrintout(valueRange *sheets.ValueRange) {
@@ -37,44 +37,88 @@ func debugPrintout(valueRange *sheets.ValueRange) {
 
 // Update updates the target spreadsheet from source spreadsheet.
 func (trg *Target) Update(client *http.Client, srcSheetID string, srcAddressRange []string) error {
+	return trg.UpdateContext(context.Background(), client, srcSheetID, srcAddressRange)
+}
+
+// UpdateContext updates the target spreadsheet from source spreadsheet.
+func (trg *Target) UpdateContext(ctx context.Context, client *http.Client, srcSheetID string, srcAddressRange []string) error {
+	sourcer, err := newSheetSvc(client, srcSheetID)
+	if err != nil {
+		return err
+	}
+	return trg.update(ctx, client, sourcer, srcAddressRange)
+}
+
+// update updates the target spreadsheet with the values read from sourcer.
+func (trg *Target) update(ctx context.Context, client *http.Client, sourcer sheetReader, srcAddressRange []string) error {
 	log.Printf("updating data in target spreadsheet %s", trg.SpreadsheetID)
 
-	// TODO: copy everything from spreadsheet if sheetAddressRange and ts.SheetAddress is nil.
-	if len(srcAddressRange) == 0 || len(trg.SheetAddress) == 0 {
-		return errEmptyRange
+	if err := trg.validateMode(); err != nil {
+		return err
 	}
-	if len(srcAddressRange) != len(trg.SheetAddress) {
-		return errLengthMismatch
+
+	srcAddressRange, trgAddress, err := resolveRanges(ctx, sourcer, srcAddressRange, trg.SheetAddress)
+	if err != nil {
+		return err
 	}
 
-	sheetsService, err := sheets.New(client)
+	copier, err := trg.copier(sourcer, srcAddressRange, trgAddress)
 	if err != nil {
 		return err
 	}
-	sourcer := sheetSvc{svc: sheetsService, spreadsheetID: srcSheetID}
-	updater := sheetSvc{svc: sheetsService, spreadsheetID: trg.SpreadsheetID}
+
+	updater, err := newSheetSvc(client, trg.SpreadsheetID)
+	if err != nil {
+		return err
+	}
+	// the target is read with the same options as the source, so that the
+	// upsert keys match.
+	updater.opts = trg.valueOptions()
+	sourcer = withValueOptions(sourcer, updater.opts)
 
 	// validation of SheetAddresses
-	if _, err := updater.validate(trg.SheetAddress, trg.Create); err != nil {
+	if _, err := updater.validate(ctx, trgAddress, trg.Create); err != nil {
 		return err
 	}
 
 	for sheetIdx := range srcAddressRange {
-		log.Printf("  * copy range %q to %q", srcAddressRange[sheetIdx], trg.SheetAddress[sheetIdx])
+		if copier != nil {
+			if err := trg.copySheet(ctx, updater, copier, srcAddressRange[sheetIdx], trgAddress[sheetIdx]); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("  * copy range %q to %q", srcAddressRange[sheetIdx], trgAddress[sheetIdx])
 		// getting source values
-		values, err := sourcer.get(srcAddressRange[sheetIdx])
+		values, err := sourcer.get(ctx, srcAddressRange[sheetIdx])
 		if err != nil {
 			return err
 		}
-		values.Range = trg.SheetAddress[sheetIdx]
+		values.Range = trgAddress[sheetIdx]
 		if trg.Clear {
 			// clearing the spreadsheet
 			log.Print("    * clearing target sheet")
-			if _, err := updater.clear(trg.SheetAddress[sheetIdx]); err != nil {
+			if _, err := updater.clear(ctx, trgAddress[sheetIdx]); err != nil {
 				return err
 			}
 		}
-		resp, err := updater.update(values)
+		switch trg.Mode {
+		case ModeAppend:
+			appended, err := trg.appendValues(ctx, updater, values)
+			if err != nil {
+				return err
+			}
+			log.Printf("    * OK: %d cells appended", appended)
+			continue
+		case ModeUpsert:
+			m, err := trg.upsertValues(ctx, updater, values)
+			if err != nil {
+				return err
+			}
+			log.Printf("    * OK: %d rows updated, %d rows added, %d rows deleted", len(m.updates)-m.appended, m.appended, len(m.deleted))
+			continue
+		}
+		resp, err := updater.update(ctx, values)
 		if err != nil {
 			return err
 		}
@@ -85,7 +129,7 @@ func (trg *Target) Update(client *http.Client, srcSheetID string, srcAddressRang
 	if trg.Location != "" {
 		//save the file if location is set
 		log.Printf("  * exporting to %s", trg.Location)
-		if err := trg.download(client); err != nil {
+		if err := trg.download(ctx, client); err != nil {
 			log.Print("    * export FAILED")
 			return err
 		}
@@ -95,8 +139,84 @@ func (trg *Target) Update(client *http.Client, srcSheetID string, srcAddressRang
 	return nil
 }
 
+// validateMode checks that the target mode and its options are valid.
+func (trg *Target) validateMode() error {
+	switch trg.Mode {
+	case "", ModeOverwrite, ModeAppend:
+	case ModeUpsert:
+		if len(trg.KeyColumns) == 0 {
+			return errNoKeyColumns
+		}
+		if trg.Clear {
+			return errUpsertAndClear
+		}
+	default:
+		return fmt.Errorf("%w: %q", errUnknownMode, trg.Mode)
+	}
+	if trg.CopySheet && trg.Mode != "" && trg.Mode != ModeOverwrite {
+		return errCopySheetMode
+	}
+	if trg.ReplaceSheet && !trg.CopySheet {
+		return errReplaceSheet
+	}
+	return trg.valueOptions().validate()
+}
+
+// appendValues appends the values below the existing data in the target
+// range and returns the number of cells appended.  If SkipHeader is set, and
+// the target already contains data, the first row of values is not appended.
+func (trg *Target) appendValues(ctx context.Context, updater *sheetSvc, values *sheets.ValueRange) (int64, error) {
+	if trg.SkipHeader && len(values.Values) > 0 {
+		hasData, err := updater.hasData(ctx, values.Range)
+		if err != nil {
+			return 0, err
+		}
+		if hasData {
+			log.Print("    * skipping the header row")
+			values.Values = values.Values[1:]
+		}
+	}
+	if len(values.Values) == 0 {
+		return 0, nil
+	}
+	resp, err := updater.append(ctx, values)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Updates == nil {
+		return 0, nil
+	}
+	return resp.Updates.UpdatedCells, nil
+}
+
+// resolveRanges checks the source and target ranges.  If both source and
+// target ranges are empty, it returns the titles of all source worksheets as
+// both source and target ranges, so that every worksheet is copied to the
+// worksheet with the same name.
+func resolveRanges(ctx context.Context, sourcer sheetReader, srcAddressRange, trgAddress []string) ([]string, []string, error) {
+	if len(srcAddressRange) == 0 && len(trgAddress) == 0 {
+		titles, err := sourcer.titles(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Printf("  * copying all worksheets: %q", titles)
+		addresses := make([]string, len(titles))
+		for i := range titles {
+			addresses[i] = quoteSheet(titles[i])
+		}
+		srcAddressRange, trgAddress = addresses, addresses
+	}
+	if len(srcAddressRange) == 0 || len(trgAddress) == 0 {
+		return nil, nil, errEmptyRange
+	}
+	if len(srcAddressRange) != len(trgAddress) {
+		return nil, nil, errLengthMismatch
+	}
+	return srcAddressRange, trgAddress, nil
+}
+
 // download downloads the spreadsheet.
-func (trg *Target) download(client *http.Client) error {
+func (trg *Target) download(ctx context.Context, client *http.Client) error {
 	if trg.Location == "" {
 		return errors.New("target location is empty")
 	}
@@ -104,11 +224,23 @@ func (trg *Target) download(client *http.Client) error {
 	if err != nil {
 		return err
 	}
-	resp, err := drv.Files.
-		Export(
-			trg.SpreadsheetID,
-			mime.TypeByExtension(filepath.Ext(trg.Location))).
-		Download()
+	// the file is read into memory, so that the download could be retried
+	// without truncating the local file.
+	var data []byte
+	err = retry(ctx, func() error {
+		resp, err := drv.Files.
+			Export(
+				trg.SpreadsheetID,
+				mime.TypeByExtension(filepath.Ext(trg.Location))).
+			Context(ctx).
+			Download()
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, err = io.ReadAll(resp.Body)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -120,7 +252,7 @@ func (trg *Target) download(client *http.Client) error {
 		return err
 	}
 	defer f.Close()
-	if _, err := io.Copy(f, resp.Body); err != nil {
+	if _, err := f.Write(data); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,44 @@
+package xls2sheets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_resolveRanges(t *testing.T) {
+	wb := &workbook{sheets: []*worksheet{{title: "Data"}, {title: "Bob's rates"}}}
+	type args struct {
+		srcAddressRange []string
+		trgAddress      []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantSrc []string
+		wantTrg []string
+		wantErr error
+	}{
+		{"as is", args{[]string{"Data!A1:B"}, []string{"Out"}}, []string{"Data!A1:B"}, []string{"Out"}, nil},
+		{"whole workbook", args{nil, nil}, []string{"'Data'", "'Bob''s rates'"}, []string{"'Data'", "'Bob''s rates'"}, nil},
+		{"empty target", args{[]string{"Data"}, nil}, nil, nil, errEmptyRange},
+		{"empty source", args{nil, []string{"Data"}}, nil, nil, errEmptyRange},
+		{"mismatch", args{[]string{"Data", "Data"}, []string{"Out"}}, nil, nil, errLengthMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSrc, gotTrg, err := resolveRanges(context.Background(), wb, tt.args.srcAddressRange, tt.args.trgAddress)
+			if err != tt.wantErr {
+				t.Errorf("resolveRanges() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.wantSrc, gotSrc); diff != "" {
+				t.Errorf("resolveRanges() source mismatch (-want,+got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantTrg, gotTrg); diff != "" {
+				t.Errorf("resolveRanges() target mismatch (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
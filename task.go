@@ -1,9 +1,17 @@
 package xls2sheets
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// cleanupTimeout is the time allowed for deleting the temporary file.
+const cleanupTimeout = 30 * time.Second
+
 // NewTask creates the task
 func NewTask(source *Source, target *Target) *Task {
 	t := &Task{
@@ -15,19 +23,112 @@ func NewTask(source *Source, target *Target) *Task {
 
 // Run runs the refresh task
 func (task *Task) Run(client *http.Client) error {
+	return task.RunContext(context.Background(), client)
+}
+
+// RunContext runs the refresh task.  The temporary file is deleted even if
+// the context is cancelled.
+func (task *Task) RunContext(ctx context.Context, client *http.Client) error {
+	return task.run(ctx, client, client, nil)
+}
+
+// run runs the refresh task, reading the source with src client and updating
+// the target with trg client.  If lock is not nil, it is held while the
+// target is updated.
+func (task *Task) run(ctx context.Context, src, trg *http.Client, lock sync.Locker) error {
+	if lock == nil {
+		lock = noLock{}
+	}
+	if task.Source.Local {
+		// read the source file locally and copy data directly to the target.
+		wb, err := task.Source.load(ctx)
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		return task.Target.update(ctx, trg, wb, task.Source.SheetAddressRange)
+	}
 	// fetch from source and upload to google drive
-	tempSpreadsheetID, err := task.Source.Process(client)
+	ctx = withTempFolder(ctx, task.TempFolderID)
+	tempSpreadsheetID, err := task.Source.ProcessContext(ctx, src)
 	if err != nil {
 		return err
 	}
 	// this ensures that the temporary file is deleted at the end of
 	// conversion
-	if !task.LeaveJunk {
-		defer task.Source.Delete(client)
+	if task.LeaveJunk {
+		task.keepJunk(ctx, tempSpreadsheetID)
+	} else {
+		defer task.cleanup(ctx, src)
+	}
+	sourcer, err := newSheetSvc(src, tempSpreadsheetID)
+	if err != nil {
+		return err
 	}
 	// copy data from temporary file to target file
-	if err := task.Target.Update(client, tempSpreadsheetID, task.Source.SheetAddressRange); err != nil {
+	lock.Lock()
+	defer lock.Unlock()
+	if err := task.Target.update(ctx, trg, sourcer, task.Source.SheetAddressRange); err != nil {
 		return err
 	}
 	return nil
 }
+
+// checkSource returns the current state of the task source, and true if the
+// source has not changed since prev.
+func (task *Task) checkSource(ctx context.Context, client *http.Client, prev *SourceState) (*SourceState, bool, error) {
+	if prev != nil && prev.SpreadsheetID != task.Target.SpreadsheetID {
+		prev = nil
+	}
+	// the configuration is hashed before the source is initialised by
+	// check, as it changes the source.
+	config, err := task.configHash()
+	if err != nil {
+		return nil, false, err
+	}
+	st, err := task.Source.check(ctx, client, prev)
+	if err != nil {
+		return nil, false, err
+	}
+	st.SpreadsheetID = task.Target.SpreadsheetID
+	st.Config = config
+	return st, st.unchanged(prev), nil
+}
+
+// cleanup deletes the temporary file.  The task context is detached, so
+// that the file is deleted even if the task was cancelled.
+func (task *Task) cleanup(ctx context.Context, client *http.Client) {
+	ctx, cancel := context.WithTimeout(detached{ctx}, cleanupTimeout)
+	defer cancel()
+	if err := task.Source.DeleteContext(ctx, client); err != nil && !errors.Is(err, errNothingToDelete) {
+		log.Printf("failed to delete the temporary file: %s", err)
+	}
+}
+
+// tempFolder returns the folder for the temporary spreadsheet of the task,
+// given the job folder.
+func (task *Task) tempFolder(jobFolder string) string {
+	if task.TempFolderID != "" {
+		return task.TempFolderID
+	}
+	return jobFolder
+}
+
+// keepJunk removes the temporary file that is left on purpose from the
+// journal, so that it is not purged on the next start.
+func (task *Task) keepJunk(ctx context.Context, id string) {
+	jr, _ := journalFrom(ctx)
+	if jr == nil {
+		return
+	}
+	if err := jr.forget(id); err != nil {
+		log.Printf("failed to update the journal: %s", err)
+	}
+}
+
+// noLock is a sync.Locker that does nothing.
+type noLock struct{}
+
+func (noLock) Lock()   {}
+func (noLock) Unlock() {}
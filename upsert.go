@@ -0,0 +1,303 @@
+package xls2sheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+var (
+	errNoKeyColumns   = errors.New("upsert mode requires key_columns")
+	errUpsertAndClear = errors.New("clear can not be used in upsert mode")
+	errDuplicateKey   = errors.New("duplicate key")
+)
+
+// keySep separates the values of the key columns in the row key.
+const keySep = "\x00"
+
+// unformatted are the value options to read the target values as they are
+// stored, numbers and dates as numbers, regardless of their formatting.
+var unformatted = valueOptions{render: RenderUnformatted, dateTime: DateTimeSerial}
+
+// merge is the result of matching the source rows with the target rows.
+type merge struct {
+	updates  []*sheets.ValueRange // rows to update in place, and new rows.
+	appended int                  // number of new rows.
+	deleted  []int                // zero-based indexes of rows to delete, descending.
+}
+
+// keyIndexes converts the key column letters to the zero-based column
+// indexes.  Key columns can't be to the left of the startCol.
+func keyIndexes(keyColumns []string, startCol int) ([]int, error) {
+	if len(keyColumns) == 0 {
+		return nil, errNoKeyColumns
+	}
+	keys := make([]int, len(keyColumns))
+	for i, kc := range keyColumns {
+		col, row, err := parseCell(kc)
+		if err != nil || col < 0 || row >= 0 {
+			return nil, fmt.Errorf("invalid key column: %q", kc)
+		}
+		if col < startCol {
+			return nil, fmt.Errorf("key column %q is outside of the target range", kc)
+		}
+		keys[i] = col
+	}
+	return keys, nil
+}
+
+// normValue returns the value in the normalised form, so that the values
+// that are stored the same way after they are written are equal, i.e. "00123"
+// and 123, "3.0000000000000004" and 3, or "2024-01-02" and its serial number
+// 45293.  Numbers are compared with 15 significant digits, as Sheets stores
+// them.
+func normValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return formatNumber(v)
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return formatNumber(f)
+		}
+		if serial, ok := parseSerialDate(v); ok {
+			return formatNumber(serial)
+		}
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', 15, 64)
+}
+
+// cellEqual returns true if the value v equals either the formatted or the
+// unformatted value of the target cell.  Nil raw value is not compared, as
+// the unformatted values were not read.
+func cellEqual(v, formatted, raw interface{}) bool {
+	n := normValue(v)
+	return n == normValue(formatted) || (raw != nil && n == normValue(raw))
+}
+
+// rowAt returns the row r of values, or nil, if there's no such row.
+func rowAt(values [][]interface{}, r int) []interface{} {
+	if r < len(values) {
+		return values[r]
+	}
+	return nil
+}
+
+// cellAt returns the value of the cell c of the row, or nil, if there's no
+// such row, or an empty string, if the row is shorter.
+func cellAt(row []interface{}, c int) interface{} {
+	switch {
+	case row == nil:
+		return nil
+	case c < len(row):
+		return row[c]
+	}
+	return ""
+}
+
+// rowKey returns the key of the row, the first column of the row has the
+// index of startCol.  The values of the key are normalised with normValue.
+// The key is empty if all key cells are empty.
+func rowKey(row []interface{}, keys []int, startCol int) string {
+	parts := make([]string, len(keys))
+	empty := true
+	for i, col := range keys {
+		if idx := col - startCol; idx < len(row) {
+			parts[i] = normValue(row[idx])
+		}
+		empty = empty && parts[i] == ""
+	}
+	if empty {
+		return ""
+	}
+	return strings.Join(parts, keySep)
+}
+
+// keyString returns the key in the human readable form.
+func keyString(key string) string {
+	return strings.ReplaceAll(key, keySep, ", ")
+}
+
+// mergeRows matches src rows with the existing rows of the target sheet on the
+// key columns.  The existing rows are the values of the whole sheet, starting
+// at A1, as displayed, and raw are the same values unformatted (optional).
+// The source values are written at startRow and startCol.  The source values
+// match the target ones, if they are equal to either the formatted or the
+// unformatted value, after normalisation.  Matched rows that have changed are
+// updated in place, rows with new keys are added after the last existing row.
+// If deleteMissing is true, the existing rows with the keys that are not
+// present in the source are deleted.  Keys must be unique both in the source
+// and in the target, otherwise it returns the errDuplicateKey error, as the
+// rows can't be matched unambiguously.
+func mergeRows(sheet string, existing, raw, src [][]interface{}, startRow, startCol int, keys []int, deleteMissing bool) (*merge, error) {
+	rows := len(existing)
+	if len(raw) > rows {
+		rows = len(raw)
+	}
+	// each row is indexed by both its formatted and unformatted key.
+	index := make(map[string]int, rows)
+	for r := startRow; r < rows; r++ {
+		for _, row := range [][]interface{}{rowAt(existing, r), rowAt(raw, r)} {
+			key := rowKey(row, keys, 0)
+			if key == "" {
+				continue
+			}
+			if first, seen := index[key]; seen && first != r {
+				return nil, fmt.Errorf("%w: %q in rows %d and %d of the target sheet %q", errDuplicateKey, keyString(key), first+1, r+1, sheet)
+			}
+			index[key] = r
+		}
+	}
+
+	// width of the source data, so that the shorter rows would clear the
+	// stale values in the target.
+	width := 0
+	for _, row := range src {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	var m merge
+	nextRow := rows
+	if nextRow < startRow {
+		nextRow = startRow
+	}
+	matched := make(map[int]bool, len(src))
+	seen := make(map[string]int, len(src))
+	for i, row := range src {
+		key := rowKey(row, keys, startCol)
+		if key == "" {
+			continue // rows without the key can't be matched.
+		}
+		if first, dup := seen[key]; dup {
+			return nil, fmt.Errorf("%w: %q in rows %d and %d of the source", errDuplicateKey, keyString(key), first+1, i+1)
+		}
+		seen[key] = i
+		padded := make([]interface{}, width)
+		for i := range padded {
+			padded[i] = ""
+			if i < len(row) {
+				padded[i] = row[i]
+			}
+		}
+		r, found := index[key]
+		if found {
+			matched[r] = true
+		}
+		if found && !rowChanged(rowAt(existing, r), rowAt(raw, r), padded, startCol) {
+			continue
+		}
+		if !found {
+			r = nextRow
+			nextRow++
+			m.appended++
+		}
+		m.updates = append(m.updates, &sheets.ValueRange{
+			Range:  quoteSheet(sheet) + "!" + colName(startCol) + strconv.Itoa(r+1),
+			Values: [][]interface{}{padded},
+		})
+	}
+
+	if deleteMissing {
+		deleted := make(map[int]bool)
+		for _, r := range index {
+			if !matched[r] && !deleted[r] {
+				deleted[r] = true
+				m.deleted = append(m.deleted, r)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(m.deleted)))
+	}
+	return &m, nil
+}
+
+// rowsWithKeys returns the zero-based indexes of the rows, starting at
+// startRow, that have one of the keys, in descending order.
+func rowsWithKeys(existing [][]interface{}, startRow int, keys []int, want map[string]bool) []int {
+	var rows []int
+	for r := len(existing) - 1; r >= startRow; r-- {
+		if key := rowKey(existing[r], keys, 0); key != "" && want[key] {
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+// rowChanged returns true if the values of the existing row, starting at
+// startCol, are different from vals.  raw is the same row unformatted, or
+// nil.
+func rowChanged(existing, raw []interface{}, vals []interface{}, startCol int) bool {
+	for i := range vals {
+		if !cellEqual(vals[i], cellAt(existing, startCol+i), cellAt(raw, startCol+i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// upsertValues updates the target rows that have the same keys as the source
+// rows, adds the new rows, and optionally deletes the target rows that are
+// missing in the source.
+func (trg *Target) upsertValues(ctx context.Context, updater *sheetSvc, values *sheets.ValueRange) (*merge, error) {
+	rng, err := parseA1(values.Range)
+	if err != nil {
+		return nil, err
+	}
+	if rng.sheet == "" {
+		return nil, fmt.Errorf("upsert mode requires the sheet name in the address: %q", values.Range)
+	}
+	keys, err := keyIndexes(trg.KeyColumns, rng.startCol)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := updater.get(ctx, quoteSheet(rng.sheet))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := withValueOptions(updater, unformatted).get(ctx, quoteSheet(rng.sheet))
+	if err != nil {
+		return nil, err
+	}
+	m, err := mergeRows(rng.sheet, existing.Values, raw.Values, values.Values, rng.startRow, rng.startCol, keys, trg.DeleteMissing)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.updates) > 0 {
+		if _, err := updater.update(ctx, m.updates...); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.deleted) > 0 {
+		log.Printf("    * deleting %d rows missing in the source", len(m.deleted))
+		// the rows are found by their keys, if the deletion has to be
+		// repeated, as the failed one might have deleted some of them.
+		deleteKeys := make(map[string]bool, len(m.deleted))
+		for _, r := range m.deleted {
+			deleteKeys[rowKey(existing.Values[r], keys, 0)] = true
+		}
+		find := func() ([]int, error) {
+			current, err := updater.get(ctx, quoteSheet(rng.sheet))
+			if err != nil {
+				return nil, err
+			}
+			return rowsWithKeys(current.Values, rng.startRow, keys, deleteKeys), nil
+		}
+		if err := updater.deleteRows(ctx, rng.sheet, m.deleted, find); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
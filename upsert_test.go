@@ -0,0 +1,218 @@
+package xls2sheets
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/sheets/v4"
+)
+
+func Test_keyIndexes(t *testing.T) {
+	tests := []struct {
+		name       string
+		keyColumns []string
+		startCol   int
+		want       []int
+		wantErr    bool
+	}{
+		{"ok", []string{"A", "c"}, 0, []int{0, 2}, false},
+		{"empty", nil, 0, nil, true},
+		{"cell reference", []string{"A1"}, 0, nil, true},
+		{"left of start", []string{"A"}, 1, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keyIndexes(tt.keyColumns, tt.startCol)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("keyIndexes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("keyIndexes() mismatch (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_mergeRows(t *testing.T) {
+	// target data starts at B2, column D has annotations.
+	existing := [][]interface{}{
+		{"title"},
+		{"", "ID", "Rate", "Note"},
+		{"", "1", "1.5", "keep me"},
+		{"", "2", "2.5"},
+		{"", "3", "3.5", "gone"},
+	}
+	src := [][]interface{}{
+		{"ID", "Rate"},
+		{"2", "2.75"},
+		{"1", "1.5"},
+		{"4"},
+		{"", "no key"},
+	}
+	tests := []struct {
+		name          string
+		deleteMissing bool
+		want          *merge
+	}{
+		{"keep missing", false, &merge{
+			updates: []*sheets.ValueRange{
+				{Range: "'Data'!B4", Values: [][]interface{}{{"2", "2.75"}}},
+				{Range: "'Data'!B6", Values: [][]interface{}{{"4", ""}}},
+			},
+			appended: 1,
+		}},
+		{"delete missing", true, &merge{
+			updates: []*sheets.ValueRange{
+				{Range: "'Data'!B4", Values: [][]interface{}{{"2", "2.75"}}},
+				{Range: "'Data'!B6", Values: [][]interface{}{{"4", ""}}},
+			},
+			appended: 1,
+			deleted:  []int{4},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeRows("Data", existing, nil, src, 1, 1, []int{1}, tt.deleteMissing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(merge{})); diff != "" {
+				t.Errorf("mergeRows() mismatch (-want,+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_mergeRows_emptyTarget(t *testing.T) {
+	src := [][]interface{}{{"a", "1"}, {"b", "2"}}
+	got, err := mergeRows("New", nil, nil, src, 4, 0, []int{0}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &merge{
+		updates: []*sheets.ValueRange{
+			{Range: "'New'!A5", Values: [][]interface{}{{"a", "1"}}},
+			{Range: "'New'!A6", Values: [][]interface{}{{"b", "2"}}},
+		},
+		appended: 2,
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(merge{})); diff != "" {
+		t.Errorf("mergeRows() mismatch (-want,+got):\n%s", diff)
+	}
+}
+
+func Test_mergeRows_duplicateKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing [][]interface{}
+		src      [][]interface{}
+	}{
+		{"source", [][]interface{}{{"1", "one"}}, [][]interface{}{{"1", "one"}, {"2", "two"}, {"1", "uno"}}},
+		{"target", [][]interface{}{{"1", "one"}, {"2", "two"}, {"1", "uno"}}, [][]interface{}{{"1", "one"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mergeRows("Data", tt.existing, nil, tt.src, 0, 0, []int{0}, false); !errors.Is(err, errDuplicateKey) {
+				t.Errorf("mergeRows() error = %v, want %v", err, errDuplicateKey)
+			}
+		})
+	}
+}
+
+func Test_rowsWithKeys(t *testing.T) {
+	existing := [][]interface{}{
+		{"id"},
+		{"1"},
+		{"2"},
+		{"3"},
+		{"2"},
+	}
+	got := rowsWithKeys(existing, 1, []int{0}, map[string]bool{"2": true, "4": true})
+	if diff := cmp.Diff([]int{4, 2}, got); diff != "" {
+		t.Errorf("rowsWithKeys() mismatch (-want,+got):\n%s", diff)
+	}
+}
+
+func Test_normValue(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"text", "abc", "abc"},
+		{"leading zeros", "00123", "123"},
+		{"number", 123.0, "123"},
+		{"float error", "3.0000000000000004", "3"},
+		{"iso date", "2024-01-02", "45293"},
+		{"iso date time", "2024-01-02 12:00:00", "45293.5"},
+		{"time", "06:00:00", "0.25"},
+		{"bool", true, "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normValue(tt.v); got != tt.want {
+				t.Errorf("normValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// enter writes the merge to the formatted and raw values, the way Sheets
+// stores the values entered by the user: numbers and ISO dates become
+// numbers, that are displayed with the formatting.
+func enter(t *testing.T, formatted, raw [][]interface{}, m *merge) ([][]interface{}, [][]interface{}) {
+	t.Helper()
+	for _, vr := range m.updates {
+		rng, err := parseA1(vr.Range)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for len(formatted) <= rng.startRow {
+			formatted, raw = append(formatted, nil), append(raw, nil)
+		}
+		var frow, rrow []interface{}
+		for _, v := range vr.Values[0] {
+			s := v.(string)
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				frow, rrow = append(frow, strconv.FormatFloat(f, 'f', 2, 64)), append(rrow, f)
+			} else if serial, ok := parseSerialDate(s); ok {
+				frow, rrow = append(frow, "1/2/2024"), append(rrow, serial)
+			} else {
+				frow, rrow = append(frow, s), append(rrow, s)
+			}
+		}
+		formatted[rng.startRow], raw[rng.startRow] = frow, rrow
+	}
+	return formatted, raw
+}
+
+func Test_mergeRows_twice(t *testing.T) {
+	// the values of the local source are not formatted.
+	src := [][]interface{}{
+		{"00123", "text key"},
+		{"3.0000000000000004", "float key"},
+		{"2024-01-02", "date key"},
+	}
+	formatted := [][]interface{}{{"Key", "Value"}}
+	raw := [][]interface{}{{"Key", "Value"}}
+	first, err := mergeRows("Data", formatted, raw, src, 1, 0, []int{0}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.appended != 3 {
+		t.Fatalf("first mergeRows() appended %d rows, want 3", first.appended)
+	}
+	formatted, raw = enter(t, formatted, raw, first)
+
+	second, err := mergeRows("Data", formatted, raw, src, 1, 0, []int{0}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&merge{}, second, cmp.AllowUnexported(merge{})); diff != "" {
+		t.Errorf("second mergeRows() must not change anything (-want,+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,91 @@
+package xls2sheets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Value render options, that define how the values are read.
+// Reference: https://developers.google.com/sheets/api/reference/rest/v4/ValueRenderOption
+const (
+	RenderFormatted   = "FORMATTED_VALUE"   // values as displayed, i.e. "1,234.50" (default)
+	RenderUnformatted = "UNFORMATTED_VALUE" // values without formatting, i.e. 1234.5
+	RenderFormula     = "FORMULA"           // formulas instead of the calculated values
+)
+
+// Date and time render options, that define how the dates are read if the
+// values are not formatted.
+// Reference: https://developers.google.com/sheets/api/reference/rest/v4/DateTimeRenderOption
+const (
+	DateTimeSerial    = "SERIAL_NUMBER"    // days since December 30, 1899 (default)
+	DateTimeFormatted = "FORMATTED_STRING" // dates as displayed
+)
+
+// Value input options, that define how the values are written.
+// Reference: https://developers.google.com/sheets/api/reference/rest/v4/ValueInputOption
+const (
+	InputRaw         = "RAW"          // values are stored as is
+	InputUserEntered = "USER_ENTERED" // values are parsed as if typed in (default)
+)
+
+var errUnknownOption = errors.New("unknown option value")
+
+// valueOptions are the options of reading and writing values of the
+// spreadsheet.  Empty options use the API defaults, except for the input
+// option, that defaults to InputUserEntered.
+type valueOptions struct {
+	render   string
+	dateTime string
+	input    string
+}
+
+// valueOptions returns the value options of the target, the option values
+// are case insensitive.
+func (trg *Target) valueOptions() valueOptions {
+	return valueOptions{
+		render:   strings.ToUpper(trg.ValueRenderOption),
+		dateTime: strings.ToUpper(trg.DateTimeRenderOption),
+		input:    strings.ToUpper(trg.ValueInputOption),
+	}
+}
+
+// validate checks that the options have the known values.
+func (o valueOptions) validate() error {
+	checks := []struct {
+		name  string
+		value string
+		valid []string
+	}{
+		{"value_render_option", o.render, []string{RenderFormatted, RenderUnformatted, RenderFormula}},
+		{"date_time_render_option", o.dateTime, []string{DateTimeSerial, DateTimeFormatted}},
+		{"value_input_option", o.input, []string{InputRaw, InputUserEntered}},
+	}
+	for _, c := range checks {
+		if c.value != "" && !contains(c.valid, c.value) {
+			return fmt.Errorf("%w: %s: %q, valid values are: %s", errUnknownOption, c.name, c.value, strings.Join(c.valid, ", "))
+		}
+	}
+	return nil
+}
+
+// inputOption returns the value input option, or the default one.
+func (o valueOptions) inputOption() string {
+	if o.input == "" {
+		return InputUserEntered
+	}
+	return o.input
+}
+
+// withValueOptions returns the reader that reads the values with the
+// options.  The options do not apply to the locally read workbooks, they are
+// returned as is.
+func withValueOptions(r sheetReader, opts valueOptions) sheetReader {
+	svc, ok := r.(*sheetSvc)
+	if !ok {
+		return r
+	}
+	c := *svc
+	c.opts = opts
+	return &c
+}
@@ -0,0 +1,91 @@
+package xls2sheets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+func TestTarget_valueOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		trg     *Target
+		wantErr error
+	}{
+		{"defaults", &Target{}, nil},
+		{"valid", &Target{ValueRenderOption: RenderFormula, DateTimeRenderOption: DateTimeFormatted, ValueInputOption: InputRaw}, nil},
+		{"lower case", &Target{ValueRenderOption: "unformatted_value", ValueInputOption: "raw"}, nil},
+		{"render", &Target{ValueRenderOption: "VALUES"}, errUnknownOption},
+		{"date time", &Target{DateTimeRenderOption: "ISO"}, errUnknownOption},
+		{"input", &Target{ValueInputOption: "PARSED"}, errUnknownOption},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.trg.validateMode(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Target.validateMode() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_sheetSvc_valueOptions(t *testing.T) {
+	var (
+		query url.Values
+		input string
+	)
+	client := apiClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			query = r.URL.Query()
+			json.NewEncoder(w).Encode(sheets.ValueRange{Values: [][]interface{}{{"0012", "=A1+1"}}})
+		case http.MethodPost:
+			var rb sheets.BatchUpdateValuesRequest
+			json.NewDecoder(r.Body).Decode(&rb)
+			input = rb.ValueInputOption
+			json.NewEncoder(w).Encode(sheets.BatchUpdateValuesResponse{})
+		}
+	}))
+	ctx := context.Background()
+	svc, err := newSheetSvc(client, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// defaults
+	if _, err := svc.get(ctx, "Data"); err != nil {
+		t.Fatal(err)
+	}
+	if query.Has("valueRenderOption") || query.Has("dateTimeRenderOption") {
+		t.Errorf("get() must use the API defaults, got %v", query)
+	}
+	if _, err := svc.update(ctx, &sheets.ValueRange{Range: "Data"}); err != nil {
+		t.Fatal(err)
+	}
+	if input != InputUserEntered {
+		t.Errorf("update() valueInputOption = %q, want %q", input, InputUserEntered)
+	}
+
+	// options
+	trg := &Target{ValueRenderOption: "formula", DateTimeRenderOption: DateTimeFormatted, ValueInputOption: InputRaw}
+	r := withValueOptions(svc, trg.valueOptions())
+	if _, err := r.get(ctx, "Data"); err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("valueRenderOption") != RenderFormula || query.Get("dateTimeRenderOption") != DateTimeFormatted {
+		t.Errorf("get() unexpected options: %v", query)
+	}
+	if _, err := r.(*sheetSvc).update(ctx, &sheets.ValueRange{Range: "Data"}); err != nil {
+		t.Fatal(err)
+	}
+	if input != InputRaw {
+		t.Errorf("update() valueInputOption = %q, want %q", input, InputRaw)
+	}
+	if svc.opts != (valueOptions{}) {
+		t.Error("withValueOptions() must not change the original reader")
+	}
+}
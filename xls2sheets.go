@@ -1,9 +1,12 @@
 package xls2sheets
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"sort"
+	"sync"
 
 	"github.com/goccy/go-yaml"
 )
@@ -11,6 +14,39 @@ import (
 // Job is a collection of Tasks
 type Job struct {
 	Tasks Tasks
+	// Parallel is the number of tasks that are run simultaneously.  Tasks
+	// that update the same spreadsheet never write to it at the same time.
+	// Values less than 2 mean that tasks are run one after another.
+	Parallel int
+	// OnError is the default error policy for tasks, either "continue"
+	// (default) or "abort".
+	OnError string
+	// State (optional) is the state of the sources after the last run.  If
+	// set, the tasks with unchanged sources are skipped, unless Force is
+	// true.  State is saved after the job is executed.
+	State *State
+	// Force runs all tasks, even if their sources have not changed.
+	Force bool
+	// Retry is the retry policy for the failed Google API and web requests.
+	Retry RetryPolicy
+	// RateLimit limits the number of Google API requests of the job.
+	RateLimit RateLimit
+	// Clients (optional) are the clients of the auth profiles, that the
+	// tasks refer to by the profile name, i.e. to read the source with one
+	// Google account and write the target with another.  Tasks without the
+	// profile use the client passed to Execute.  See Profiles.
+	Clients map[string]*http.Client
+	// GC (optional) deletes the temporary files left by the previous runs
+	// before the tasks are started, see CollectGarbage.
+	GC *GCOptions
+	// TempFolderID (optional) is the ID of the Drive folder, where the
+	// temporary spreadsheets are created, it may be on the shared drive.
+	// Tasks may override it.  If empty, the files are created in My Drive
+	// root.
+	TempFolderID string
+	// Journal (optional) records the temporary files, so that the files left
+	// by the crashed run are deleted before the tasks are started.
+	Journal *Journal
 
 	sortedNames []string // cache of sorted task names
 }
@@ -25,6 +61,19 @@ type Task struct {
 	Target *Target `yaml:"target"` // Target sheet info (defined below)
 
 	LeaveJunk bool `yaml:"leave_junk,omitempty"` // leave temporary files on google disk
+	// DependsOn (optional) lists the names of the tasks that must succeed
+	// before this task is started.
+	DependsOn []string `yaml:"depends_on,omitempty"`
+	// OnError (optional) is the error policy of the task, it overrides the
+	// job policy.  "continue" runs the rest of the tasks if this task
+	// fails, "abort" stops the job.
+	OnError string `yaml:"on_error,omitempty"`
+	// Profile (optional) is the name of the auth profile used by the task.
+	// Source and target profiles take precedence over it.
+	Profile string `yaml:"profile,omitempty"`
+	// TempFolderID (optional) is the ID of the Drive folder for the
+	// temporary spreadsheet of the task, it overrides the job folder.
+	TempFolderID string `yaml:"temp_folder_id,omitempty"`
 }
 
 // Source contains the information about the source file and
@@ -38,11 +87,22 @@ type Source struct {
 	//      somefile.ods
 	FileLocation string `yaml:"location"`
 	// SheetAddress is the address within the source workbook.
-	// I.e. "Data!A1:U"
+	// I.e. "Data!A1:U".  If both source and target addresses are empty,
+	// all worksheets are copied.
 	SheetAddressRange []string `yaml:"address_range"`
+	// Local (optional) specifies if the source file should be read locally
+	// instead of converting it to the temporary Google Spreadsheet.  Only
+	// xlsx, ods and csv files are supported.
+	Local bool `yaml:"local,omitempty"`
+	// HTTP (optional) are the options for fetching the remote file.
+	HTTP *HTTPOptions `yaml:"http,omitempty"`
+	// Profile (optional) is the name of the auth profile used to convert
+	// and read the source.
+	Profile string `yaml:"profile,omitempty"`
 
 	fileID   string // temporary spreadsheet ID
 	tempName string //temporary spreadsheet file name
+	data     []byte // contents of the file fetched by check
 }
 
 // Target bears the information about the target spreadsheet and
@@ -57,7 +117,9 @@ type Target struct {
 	Location string `yaml:"location,omitempty"`
 	// TargetSheet specifies the start location within the target
 	// Google Sheet for all corresponding SheetAddressRange that
-	// are defined on the source.  Example:  [ Sheet2!B4, Sheet3!A1 ]
+	// are defined on the source.  Example:  [ Sheet2!B4, Sheet3!A1 ].
+	// Leave empty, along with the source address range, to copy all
+	// worksheets.
 	SheetAddress []string `yaml:"address"`
 	// Clear (optional) specifies if the process should delete all data from
 	// the Target Sheet before updating.
@@ -65,8 +127,62 @@ type Target struct {
 	// Create (optional) specifies if the process should create worksheet
 	// if it does not exist.
 	Create bool `yaml:"create,omitempty"`
+	// Mode (optional) specifies how the data is written to the target.
+	// Valid values:
+	//
+	//		overwrite - (default) write data at the target address;
+	//		append    - add data below the existing data at target address;
+	//		upsert    - update the rows with matching KeyColumns and add
+	//		            the new ones.
+	Mode string `yaml:"mode,omitempty"`
+	// SkipHeader (optional) specifies if the first row of the source data
+	// should be dropped in append mode, if the target already contains
+	// data.
+	SkipHeader bool `yaml:"skip_header,omitempty"`
+	// KeyColumns (upsert mode) are the columns of the target sheet that
+	// identify the row, i.e. [ A, C ].
+	KeyColumns []string `yaml:"key_columns,omitempty"`
+	// DeleteMissing (upsert mode) specifies if the target rows, that are not
+	// present in the source, should be deleted.
+	DeleteMissing bool `yaml:"delete_missing,omitempty"`
+	// ValueRenderOption (optional) defines how the source values are read:
+	// FORMATTED_VALUE (default), UNFORMATTED_VALUE or FORMULA.  Does not
+	// apply to the local sources.
+	ValueRenderOption string `yaml:"value_render_option,omitempty"`
+	// DateTimeRenderOption (optional) defines how the dates are read, if
+	// the values are not formatted: SERIAL_NUMBER (default) or
+	// FORMATTED_STRING.
+	DateTimeRenderOption string `yaml:"date_time_render_option,omitempty"`
+	// ValueInputOption (optional) defines how the values are written: RAW
+	// stores them as is, USER_ENTERED (default) parses them as if they were
+	// typed in, i.e. "0012" becomes 12.
+	ValueInputOption string `yaml:"value_input_option,omitempty"`
+	// CopySheet (optional) copies the whole source worksheets with the
+	// formatting, merges, conditional formatting and data validation,
+	// instead of the values only.  Each copy is pasted into the target
+	// worksheet, so the references to it in other worksheets' formulas are
+	// kept.  Addresses must be the worksheet names, and the mode must be
+	// overwrite.  The source profile must be allowed to edit the target
+	// spreadsheet.
+	CopySheet bool `yaml:"copy_sheet,omitempty"`
+	// ReplaceSheet (copy_sheet) replaces the target worksheet with the copy,
+	// instead of pasting it, so that the charts and column widths are
+	// copied as well.  The copy keeps the ID, title and position of the
+	// target worksheet, but the references to it in other worksheets'
+	// formulas break.
+	ReplaceSheet bool `yaml:"replace_sheet,omitempty"`
+	// Profile (optional) is the name of the auth profile used to update the
+	// target.
+	Profile string `yaml:"profile,omitempty"`
 }
 
+// Target modes.
+const (
+	ModeOverwrite = "overwrite"
+	ModeAppend    = "append"
+	ModeUpsert    = "upsert"
+)
+
 // NewJobFromConfig instantiates Job from config
 func NewJobFromConfig(config []byte) (*Job, error) {
 	tasks := make(Tasks)
@@ -77,6 +193,9 @@ func NewJobFromConfig(config []byte) (*Job, error) {
 	job := &Job{
 		Tasks: tasks,
 	}
+	if err := job.validate(); err != nil {
+		return nil, err
+	}
 
 	return job, nil
 }
@@ -99,21 +218,105 @@ func (j *Job) TaskNames() []string {
 	return j.sortedNames
 }
 
-// Execute executes the job.  Tasks are ran in alphabetical order.
-// if any error occurs - the job is interrupted.
+// Execute executes the job.  Tasks are started in alphabetical order, once
+// the tasks they depend on have succeeded.  If Parallel is greater than 1, up
+// to Parallel tasks are run at the same time.  Tasks that depend on the
+// failed task are skipped.  If the error policy of the failed task is
+// "abort", no new tasks are started.  If any of the tasks did not succeed, it
+// returns *JobError.
 func (j *Job) Execute(client *http.Client) error {
+	return j.ExecuteContext(context.Background(), client)
+}
+
+// ExecuteContext executes the job, same as Execute.  If the context is
+// cancelled, running tasks are interrupted and no new tasks are started.
+func (j *Job) ExecuteContext(ctx context.Context, client *http.Client) error {
 	if len(j.Tasks) == 0 {
 		log.Println("job has no tasks, nothing to do")
 		return nil
 	}
-	for _, taskName := range j.TaskNames() {
+	if err := j.validate(); err != nil {
+		return err
+	}
+	ctx = withTempFolder(withRetryPolicy(ctx, j.Retry), j.TempFolderID)
+	clients, err := j.clients(client)
+	if err != nil {
+		return err
+	}
+	j.purgeJournal(ctx, clients)
+	if j.GC != nil {
+		j.collectGarbage(ctx, clients)
+	}
+
+	// one lock per target spreadsheet, so that tasks that share the target do
+	// not write to it simultaneously.
+	locks := make(map[string]*sync.Mutex, len(j.Tasks))
+	for _, task := range j.Tasks {
+		if task.Target != nil && locks[task.Target.SpreadsheetID] == nil {
+			locks[task.Target.SpreadsheetID] = new(sync.Mutex)
+		}
+	}
+
+	results := j.schedule(ctx, j.Parallel, func(taskName string) error {
+		task := j.Tasks[taskName]
+		var lock sync.Locker
+		if task.Target != nil {
+			lock = locks[task.Target.SpreadsheetID]
+		}
 		log.Printf("starting task: %q", taskName)
-		if err := j.Tasks[taskName].Run(client); err != nil {
+		err := j.runTask(ctx, clients, taskName, lock)
+		if err != nil {
 			log.Printf("task %q: error: %s", taskName, err)
 		} else {
 			log.Printf("task %q: success", taskName)
 		}
+		return err
+	})
+	if j.State != nil {
+		if err := j.State.Save(); err != nil {
+			log.Printf("failed to save the state: %s", err)
+		}
 	}
 
+	jobErr := &JobError{Total: len(j.Tasks), Errors: make(map[string]error)}
+	for name, err := range results {
+		if err == nil {
+			continue
+		}
+		jobErr.Errors[name] = err
+		if errors.Is(err, errAborted) {
+			jobErr.Aborted = true
+		}
+	}
+	if len(jobErr.Errors) > 0 {
+		return jobErr
+	}
+	return nil
+}
+
+// runTask runs the task.  If the job has the State, the task is skipped if
+// its source has not changed since the last successful run.
+func (j *Job) runTask(ctx context.Context, clients profileClients, taskName string, lock sync.Locker) error {
+	task := j.Tasks[taskName]
+	ctx = withJournal(ctx, j.Journal, task.sourceProfile())
+	if j.State == nil {
+		return task.run(ctx, clients.source(task), clients.target(task), lock)
+	}
+	var prev *SourceState
+	if !j.Force {
+		prev = j.State.get(taskName)
+	}
+	st, unchanged, err := task.checkSource(ctx, clients.source(task), prev)
+	if err != nil {
+		return err
+	}
+	if unchanged {
+		log.Printf("task %q: source has not changed, skipping", taskName)
+		return nil
+	}
+	if err := task.run(ctx, clients.source(task), clients.target(task), lock); err != nil {
+		return err
+	}
+	j.State.set(taskName, st)
 	return nil
 }
@@ -0,0 +1,371 @@
+package xls2sheets
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsx file parts.
+const (
+	xlsxWorkbook      = "xl/workbook.xml"
+	xlsxWorkbookRels  = "xl/_rels/workbook.xml.rels"
+	xlsxSharedStrings = "xl/sharedStrings.xml"
+	xlsxStyles        = "xl/styles.xml"
+)
+
+// xlsx cell types.
+const (
+	xlsxTypeShared    = "s"
+	xlsxTypeInline    = "inlineStr"
+	xlsxTypeBool      = "b"
+	xlsxTypeNumber    = "n"
+	xlsxTypeUndefined = ""
+)
+
+type xlsxWorkbookXML struct {
+	Pr struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelsXML struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is the text that may be either plain or rich text.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	for _, r := range t.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type xlsxSharedStringsXML struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxStylesXML struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxRow struct {
+	R     int `xml:"r,attr"`
+	Cells []struct {
+		R      string    `xml:"r,attr"`
+		T      string    `xml:"t,attr"`
+		S      int       `xml:"s,attr"`
+		V      string    `xml:"v"`
+		Inline *xlsxText `xml:"is"`
+	} `xml:"c"`
+}
+
+// xlsxReader holds the workbook-wide data required to read the worksheets.
+type xlsxReader struct {
+	files    map[string]*zip.File
+	strings  []string
+	dateFmt  []bool // dateFmt[styleIdx] is true if the style is date format
+	date1904 bool
+}
+
+// readXLSX reads the Office Open XML workbook.  Cells are read as their
+// cached values, dates are converted to ISO format.
+func readXLSX(r io.ReaderAt, size int64) (*workbook, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	xr := &xlsxReader{files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		xr.files[f.Name] = f
+	}
+
+	var wbx xlsxWorkbookXML
+	if err := xr.decode(xlsxWorkbook, &wbx); err != nil {
+		return nil, err
+	}
+	xr.date1904 = wbx.Pr.Date1904
+	var rels xlsxRelsXML
+	if err := xr.decode(xlsxWorkbookRels, &rels); err != nil {
+		return nil, err
+	}
+	if err := xr.readSharedStrings(); err != nil {
+		return nil, err
+	}
+	if err := xr.readStyles(); err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		targets[rel.ID] = rel.Target
+	}
+	var wb workbook
+	for _, sh := range wbx.Sheets {
+		target, ok := targets[sh.RID]
+		if !ok {
+			return nil, fmt.Errorf("xlsx: worksheet %q not found", sh.Name)
+		}
+		if strings.HasPrefix(target, "/") {
+			target = target[1:]
+		} else {
+			target = path.Join(path.Dir(xlsxWorkbook), target)
+		}
+		ws, err := xr.readSheet(sh.Name, target)
+		if err != nil {
+			return nil, err
+		}
+		wb.sheets = append(wb.sheets, ws)
+	}
+	if len(wb.sheets) == 0 {
+		return nil, errNoSheets
+	}
+	return &wb, nil
+}
+
+// decode decodes the xml file from the archive into v.
+func (xr *xlsxReader) decode(name string, v interface{}) error {
+	f, ok := xr.files[name]
+	if !ok {
+		return fmt.Errorf("xlsx: %s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("xlsx: %s: %w", name, err)
+	}
+	return nil
+}
+
+// readSharedStrings reads the shared strings table, it is optional.
+func (xr *xlsxReader) readSharedStrings() error {
+	if _, ok := xr.files[xlsxSharedStrings]; !ok {
+		return nil
+	}
+	var sst xlsxSharedStringsXML
+	if err := xr.decode(xlsxSharedStrings, &sst); err != nil {
+		return err
+	}
+	xr.strings = make([]string, len(sst.Items))
+	for i := range sst.Items {
+		xr.strings[i] = sst.Items[i].String()
+	}
+	return nil
+}
+
+// readStyles reads the cell styles and determines which ones are dates, the
+// styles are optional.
+func (xr *xlsxReader) readStyles() error {
+	if _, ok := xr.files[xlsxStyles]; !ok {
+		return nil
+	}
+	var st xlsxStylesXML
+	if err := xr.decode(xlsxStyles, &st); err != nil {
+		return err
+	}
+	custom := make(map[int]string, len(st.NumFmts))
+	for _, nf := range st.NumFmts {
+		custom[nf.ID] = nf.Code
+	}
+	xr.dateFmt = make([]bool, len(st.CellXfs))
+	for i, xf := range st.CellXfs {
+		if code, ok := custom[xf.NumFmtID]; ok {
+			xr.dateFmt[i] = isDateFormat(code)
+		} else {
+			xr.dateFmt[i] = isBuiltinDateFormat(xf.NumFmtID)
+		}
+	}
+	return nil
+}
+
+// readSheet reads the worksheet file.
+func (xr *xlsxReader) readSheet(title string, name string) (*worksheet, error) {
+	f, ok := xr.files[name]
+	if !ok {
+		return nil, fmt.Errorf("xlsx: %s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	ws := &worksheet{title: title}
+	dec := xml.NewDecoder(rc)
+	rowIdx := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("xlsx: %s: %w", name, err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "row" {
+			continue
+		}
+		var row xlsxRow
+		if err := dec.DecodeElement(&row, &se); err != nil {
+			return nil, fmt.Errorf("xlsx: %s: %w", name, err)
+		}
+		if row.R > 0 {
+			rowIdx = row.R - 1
+		}
+		var vals []string
+		for _, c := range row.Cells {
+			colIdx := len(vals)
+			if c.R != "" {
+				if colIdx, _, err = parseCell(c.R); err != nil || colIdx < 0 {
+					return nil, fmt.Errorf("xlsx: %s: invalid cell reference: %q", name, c.R)
+				}
+			}
+			for len(vals) <= colIdx {
+				vals = append(vals, "")
+			}
+			switch c.T {
+			case xlsxTypeShared:
+				idx, err := strconv.Atoi(c.V)
+				if err != nil || idx < 0 || len(xr.strings) <= idx {
+					return nil, fmt.Errorf("xlsx: %s: invalid shared string index in %s: %q", name, c.R, c.V)
+				}
+				vals[colIdx] = xr.strings[idx]
+			case xlsxTypeInline:
+				if c.Inline != nil {
+					vals[colIdx] = c.Inline.String()
+				}
+			case xlsxTypeBool:
+				vals[colIdx] = "FALSE"
+				if c.V == "1" {
+					vals[colIdx] = "TRUE"
+				}
+			case xlsxTypeNumber, xlsxTypeUndefined:
+				vals[colIdx] = xr.number(c.V, c.S)
+			default: // error, formula string and ISO date values are used as is.
+				vals[colIdx] = c.V
+			}
+		}
+		ws.setRow(rowIdx, vals)
+		rowIdx++
+	}
+	return ws, nil
+}
+
+// number formats the numeric value v with style s.
+func (xr *xlsxReader) number(v string, s int) string {
+	if v == "" || s < 0 || len(xr.dateFmt) <= s || !xr.dateFmt[s] {
+		return v
+	}
+	serial, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	return formatSerialDate(serial, xr.date1904)
+}
+
+// formatSerialDate converts the spreadsheet serial date to ISO date format
+// that is understood by google sheets.
+func formatSerialDate(serial float64, date1904 bool) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days, frac := math.Modf(serial)
+	secs := math.Round(frac * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(secs) * time.Second)
+	switch {
+	case days == 0 && secs != 0:
+		return t.Format("15:04:05")
+	case secs == 0:
+		return t.Format("2006-01-02")
+	default:
+		return t.Format("2006-01-02 15:04:05")
+	}
+}
+
+// parseSerialDate converts the ISO date, as formatted by formatSerialDate, to
+// the serial date.  It returns false if s is not a date.
+func parseSerialDate(s string) (float64, bool) {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Sub(epoch).Hours() / 24, true
+		}
+	}
+	if t, err := time.Parse("15:04:05", s); err == nil {
+		return float64(t.Hour()*3600+t.Minute()*60+t.Second()) / 86400, true
+	}
+	return 0, false
+}
+
+// isBuiltinDateFormat returns true if the builtin number format id is date or
+// time format.
+func isBuiltinDateFormat(id int) bool {
+	return (14 <= id && id <= 22) || (45 <= id && id <= 47)
+}
+
+// isDateFormat returns true if the custom number format code is date or time
+// format.  Quoted text, escaped characters and colours are ignored.
+func isDateFormat(code string) bool {
+	// only the first section is considered.
+	if i := strings.IndexByte(code, ';'); i >= 0 {
+		code = code[:i]
+	}
+	inQuote := false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case inQuote:
+			inQuote = c != '"'
+		case c == '"':
+			inQuote = true
+		case c == '[':
+			end := strings.IndexByte(code[i:], ']')
+			if end < 0 {
+				return false
+			}
+			// elapsed time, i.e. [h]:mm, otherwise it's a colour or locale.
+			if end > 1 && strings.Trim(strings.ToLower(code[i+1:i+end]), "hms") == "" {
+				return true
+			}
+			i += end
+		case c == '\\' || c == '_' || c == '*':
+			i++ // skip the next character
+		case strings.IndexByte("dmyhs", c|0x20) >= 0:
+			return true
+		}
+	}
+	return false
+}
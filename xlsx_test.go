@@ -0,0 +1,114 @@
+package xls2sheets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testXLSX = map[string]string{
+	xlsxWorkbook: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Data" sheetId="1" r:id="rId1"/><sheet name="Empty" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`,
+	xlsxWorkbookRels: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`,
+	xlsxSharedStrings: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="2" uniqueCount="2">
+<si><t>Date</t></si><si><r><t>Ra</t></r><r><t>te</t></r></si>
+</sst>`,
+	xlsxStyles: `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="[Red]dd/mm/yyyy"/></numFmts>
+<cellXfs count="3"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/></cellXfs>
+</styleSheet>`,
+	"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2" s="1"><v>43831</v></c><c r="B2"><v>1.5</v></c><c r="D2" t="b"><v>1</v></c></row>
+<row r="4"><c r="A4" s="2"><v>43832.5</v></c><c r="B4" t="inlineStr"><is><t>inline</t></is></c><c r="C4" t="str"><f>A1</f><v>Date</v></c></row>
+</sheetData></worksheet>`,
+	"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData/></worksheet>`,
+}
+
+func Test_readXLSX(t *testing.T) {
+	r := makeZip(t, testXLSX)
+	wb, err := readXLSX(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wb.sheets) != 2 {
+		t.Fatalf("expected 2 sheets, got %d", len(wb.sheets))
+	}
+	got, err := wb.get(context.Background(), "Data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]interface{}{
+		{"Date", "Rate"},
+		{"2020-01-01", "1.5", "", "TRUE"},
+		{},
+		{"2020-01-02 12:00:00", "inline", "Date"},
+	}
+	if diff := cmp.Diff(want, got.Values); diff != "" {
+		t.Errorf("readXLSX() mismatch (-want,+got):\n%s", diff)
+	}
+	empty, err := wb.get(context.Background(), "Empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty.Values) != 0 {
+		t.Errorf("expected no values in empty sheet, got: %v", empty.Values)
+	}
+}
+
+func Test_isDateFormat(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"General", false},
+		{"0.00", false},
+		{"dd/mm/yyyy", true},
+		{"[Red]0.00", false},
+		{"[Magenta]#,##0", false},
+		{"[h]:mm:ss", true},
+		{`"Day"0`, false},
+		{`\d0`, false},
+		{"yyyy-mm-dd hh:mm", true},
+		{"0;[Red]dd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := isDateFormat(tt.code); got != tt.want {
+				t.Errorf("isDateFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formatSerialDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		serial   float64
+		date1904 bool
+		want     string
+	}{
+		{"date", 43831, false, "2020-01-01"},
+		{"date and time", 43831.25, false, "2020-01-01 06:00:00"},
+		{"time", 0.5, false, "12:00:00"},
+		{"1904", 0, true, "1904-01-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatSerialDate(tt.serial, tt.date1904); got != tt.want {
+				t.Errorf("formatSerialDate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}